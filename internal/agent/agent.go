@@ -2,41 +2,60 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"os"
 	"strings"
+	"sync"
 
 	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/llm"
 	"github.com/Al-Pragliola/poc-dev-agents/internal/mapper"
 	"github.com/Al-Pragliola/poc-dev-agents/internal/spawner"
 	"github.com/ollama/ollama/api"
 )
 
+const (
+	defaultMaxToolSteps = 10
+	maxServerRecoveries = 2
+)
+
+var ErrMaxToolSteps = errors.New("tool step limit reached")
+
+// ToolExecutor runs a single tool call requested by the model and returns its result.
+type ToolExecutor func(ctx context.Context, name string, args map[string]any) (string, error)
+
 type ChatResponse struct {
 	Message    string         `json:"message"`
 	ToolsCalls []api.ToolCall `json:"tools_calls"`
 }
 
 type Agent struct {
+	mu              sync.Mutex
 	Spawner         spawner.Spawner
 	Engine          string
+	Server          config.Server
 	Config          config.Agent
 	MessagesHistory []api.Message
-	Client          *api.Client
+	Client          llm.Client
 	Tools           []api.Tool
+	clientURL       string
 }
 
-func NewAgent(engine string, config config.Agent) *Agent {
+func NewAgent(engine string, server config.Server, config config.Agent) *Agent {
 
 	return &Agent{
 		Engine: engine,
+		Server: server,
 		Config: config,
 		Tools:  mapper.MapConfigToolsToOllamaTools(config.Tools),
 	}
 }
 
-func (a *Agent) Setup() error {
+// Setup starts or joins the server of the agent and checks that its model is
+// available, so a misconfigured agent fails before any work starts.
+func (a *Agent) Setup(ctx context.Context) error {
 	a.MessagesHistory = []api.Message{
 		{
 			Role:    "system",
@@ -44,53 +63,262 @@ func (a *Agent) Setup() error {
 		},
 	}
 
-	spawner := spawner.NewSpawner(a.Engine)
-
 	slog.Info("Spawning agent", "engine", a.Engine, "model", a.Config.Model, "agent", a.Config.Name)
 
-	if err := spawner.Spawn(context.Background()); err != nil {
+	// Agents with the same engine settings share the server
+	spawner, err := spawner.DefaultPool.Acquire(ctx, a.Engine, a.Server, a.Config.Model)
+	if err != nil {
 		return err
 	}
 
 	a.Spawner = spawner
 
-	a.Client = api.NewClient(a.Spawner.GetUrl(), http.DefaultClient)
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	if err := llm.EnsureModel(ctx, a.Client, a.Config.Model, a.Server.PullModels); err != nil {
+		return fmt.Errorf("agent %s: %w", a.Config.Name, err)
+	}
 
 	return nil
 }
 
-func (a *Agent) Chat(ctx context.Context, message string) (ChatResponse, error) {
-	chatResponse := ChatResponse{
-		ToolsCalls: []api.ToolCall{},
+// Fork returns a new agent that shares the engine and client of a but starts
+// from a fresh conversation, so it can work on another task concurrently.
+func (a *Agent) Fork() *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return &Agent{
+		Spawner:   a.Spawner,
+		Engine:    a.Engine,
+		Server:    a.Server,
+		Config:    a.Config,
+		Client:    a.Client,
+		clientURL: a.clientURL,
+		Tools:     a.Tools,
+		MessagesHistory: []api.Message{
+			{
+				Role:    "system",
+				Content: a.Config.Prompt,
+			},
+		},
+	}
+}
+
+// connect builds the client for the current url of the server.
+func (a *Agent) connect() error {
+	// Other engines only get the configured key, so the OpenAI one never
+	// leaks to a local server
+	apiKey := a.Server.APIKey
+	if apiKey == "" && a.Engine == config.EngineOpenAI {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	u := a.Spawner.GetUrl()
+
+	client, err := llm.NewClient(a.Engine, u, apiKey)
+	if err != nil {
+		return err
 	}
 
-	a.MessagesHistory = append(a.MessagesHistory, api.Message{
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.Client = client
+	a.clientURL = u.String()
+
+	return nil
+}
+
+func (a *Agent) client() llm.Client {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.Client
+}
+
+// recoverServer reports whether the request that failed with err should be
+// retried, which is when the server was unreachable and has been restarted
+// since, possibly on another url.
+func (a *Agent) recoverServer(ctx context.Context, err error) bool {
+	var statusErr api.StatusError
+	if ctx.Err() != nil || errors.As(err, &statusErr) {
+		return false
+	}
+
+	recoverer, ok := a.Spawner.(spawner.Recoverer)
+	if !ok {
+		return false
+	}
+
+	restarted, recoverErr := recoverer.Recover(ctx)
+	if recoverErr != nil {
+		if !errors.Is(recoverErr, errors.ErrUnsupported) {
+			slog.Error("Error recovering server:", "agent", a.Config.Name, "error", recoverErr)
+		}
+
+		return false
+	}
+
+	a.mu.Lock()
+	moved := a.Spawner.GetUrl().String() != a.clientURL
+	a.mu.Unlock()
+
+	if moved {
+		if err := a.connect(); err != nil {
+			slog.Error("Error reconnecting to server:", "agent", a.Config.Name, "error", err)
+
+			return false
+		}
+
+		slog.Info("Reconnected to server", "agent", a.Config.Name, "url", a.clientURL)
+
+		return true
+	}
+
+	return restarted
+}
+
+// History returns a copy of the conversation, safe to read while the agent
+// is chatting.
+func (a *Agent) History() []api.Message {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]api.Message(nil), a.MessagesHistory...)
+}
+
+func (a *Agent) SetHistory(history []api.Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.MessagesHistory = history
+}
+
+func (a *Agent) appendHistory(messages ...api.Message) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.MessagesHistory = append(a.MessagesHistory, messages...)
+}
+
+func (a *Agent) Chat(ctx context.Context, message string) (ChatResponse, error) {
+	a.appendHistory(api.Message{
 		Role:    "user",
 		Content: message,
 	})
 
-	var fullResponse strings.Builder
-	err := a.Client.Chat(ctx, &api.ChatRequest{
-		Model:    a.Config.Model,
-		Messages: a.MessagesHistory,
-		Tools:    a.Tools,
-	}, func(response api.ChatResponse) error {
-		if len(response.Message.ToolCalls) > 0 {
-			chatResponse.ToolsCalls = append(chatResponse.ToolsCalls, response.Message.ToolCalls...)
+	return a.chat(ctx)
+}
+
+// ChatWithTools sends the message and keeps executing the requested tools,
+// feeding their results back to the model, until it stops asking for tools
+// or the configured step limit is reached.
+func (a *Agent) ChatWithTools(ctx context.Context, message string, execute ToolExecutor) (ChatResponse, error) {
+	maxSteps := a.Config.MaxToolSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultMaxToolSteps
+	}
+
+	resp, err := a.Chat(ctx, message)
+	if err != nil {
+		return resp, err
+	}
+
+	for step := 0; len(resp.ToolsCalls) > 0; step++ {
+		if step >= maxSteps {
+			// Answer every pending call, so the history stays valid for the
+			// next message sent to the agent
+			for range resp.ToolsCalls {
+				a.appendHistory(api.Message{
+					Role:    "tool",
+					Content: "not executed: step limit reached",
+				})
+			}
+
+			return resp, fmt.Errorf("%w: %d", ErrMaxToolSteps, maxSteps)
 		}
 
-		fullResponse.WriteString(response.Message.Content)
-		return nil
-	})
+		slog.Debug("The tools calls from the agent are: ", "agent", a.Config.Name, "toolsCalls", resp.ToolsCalls)
+
+		for _, toolCall := range resp.ToolsCalls {
+			var (
+				result string
+				err    error
+			)
+
+			if problem, ok := toolCall.Function.Arguments[llm.InvalidArgumentsKey].(string); ok {
+				err = errors.New(problem)
+			} else {
+				result, err = execute(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
+			}
+
+			if err != nil {
+				slog.Error("Error calling tool:", "agent", a.Config.Name, "tool", toolCall.Function.Name, "error", err)
+
+				result = fmt.Sprintf("error: %s", err)
+			} else if result == "" {
+				result = "success"
+			}
+
+			a.appendHistory(api.Message{
+				Role:    "tool",
+				Content: result,
+			})
+		}
+
+		resp, err = a.chat(ctx)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (a *Agent) chat(ctx context.Context) (ChatResponse, error) {
+	chatResponse := ChatResponse{
+		ToolsCalls: []api.ToolCall{},
+	}
+
+	var fullResponse strings.Builder
+	send := func() error {
+		chatResponse.ToolsCalls = chatResponse.ToolsCalls[:0]
+		fullResponse.Reset()
+
+		return a.client().Chat(ctx, &api.ChatRequest{
+			Model:    a.Config.Model,
+			Messages: a.History(),
+			Tools:    a.Tools,
+		}, func(response api.ChatResponse) error {
+			if len(response.Message.ToolCalls) > 0 {
+				chatResponse.ToolsCalls = append(chatResponse.ToolsCalls, response.Message.ToolCalls...)
+			}
+
+			fullResponse.WriteString(response.Message.Content)
+			return nil
+		})
+	}
+
+	err := send()
+	for attempt := 0; err != nil && attempt < maxServerRecoveries && a.recoverServer(ctx, err); attempt++ {
+		slog.Info("Retrying the request on the recovered server", "agent", a.Config.Name)
+
+		err = send()
+	}
 
 	if err != nil {
 		return chatResponse, fmt.Errorf("chat error: %w", err)
 	}
 
-	// Add the complete response to message history
-	a.MessagesHistory = append(a.MessagesHistory, api.Message{
-		Role:    "assistant",
-		Content: fullResponse.String(),
+	// Add the complete response to message history, including the requested
+	// tool calls so the model can match them with the tool results
+	a.appendHistory(api.Message{
+		Role:      "assistant",
+		Content:   fullResponse.String(),
+		ToolCalls: chatResponse.ToolsCalls,
 	})
 
 	chatResponse.Message = fullResponse.String()
@@ -98,6 +326,12 @@ func (a *Agent) Chat(ctx context.Context, message string) (ChatResponse, error)
 	return chatResponse, nil
 }
 
-func (a *Agent) Teardown() error {
-	return a.Spawner.Stop()
+// Teardown releases the server of the agent, waiting for it to stop until
+// ctx is done.
+func (a *Agent) Teardown(ctx context.Context) error {
+	if a.Spawner == nil {
+		return nil
+	}
+
+	return a.Spawner.Stop(ctx)
 }
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/llm"
+	"github.com/ollama/ollama/api"
+)
+
+// loopingClient asks for the same two tools on every request.
+type loopingClient struct{}
+
+func (loopingClient) Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	call := func(name string) api.ToolCall {
+		return api.ToolCall{Function: api.ToolCallFunction{Name: name, Arguments: api.ToolCallFunctionArguments{}}}
+	}
+
+	return fn(api.ChatResponse{
+		Message: api.Message{Role: "assistant", ToolCalls: []api.ToolCall{call("read-file"), call("list-files")}},
+		Done:    true,
+	})
+}
+
+func TestChatWithToolsAnswersPendingCallsAtStepLimit(t *testing.T) {
+	a := NewAgent(config.EngineOllama, config.Server{}, config.Agent{Name: "backend-developer", MaxToolSteps: 2})
+	a.Client = loopingClient{}
+
+	executed := 0
+
+	_, err := a.ChatWithTools(context.Background(), "build the server", func(ctx context.Context, name string, args map[string]any) (string, error) {
+		executed++
+
+		return "ok", nil
+	})
+	if !errors.Is(err, ErrMaxToolSteps) {
+		t.Fatalf("expected the step limit to be reached, got %v", err)
+	}
+
+	if executed != 4 {
+		t.Fatalf("expected 4 tools to be executed, got %d", executed)
+	}
+
+	// Every tool call must be followed by its result
+	pending := 0
+
+	for _, message := range a.History() {
+		switch message.Role {
+		case "assistant":
+			if pending != 0 {
+				t.Fatalf("expected every tool call to be answered, %d were not", pending)
+			}
+
+			pending = len(message.ToolCalls)
+		case "tool":
+			pending--
+		}
+	}
+
+	if pending != 0 {
+		t.Fatalf("expected every tool call to be answered, %d were not", pending)
+	}
+
+	if last := a.History()[len(a.History())-1]; last.Content != "not executed: step limit reached" {
+		t.Fatalf("expected the last calls to be reported as not executed, got %q", last.Content)
+	}
+}
+
+// invalidArgumentsClient sends a tool call with invalid arguments, then
+// answers without tools.
+type invalidArgumentsClient struct {
+	requests int
+}
+
+func (c *invalidArgumentsClient) Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	c.requests++
+
+	message := api.Message{Role: "assistant", Content: "done"}
+
+	if c.requests == 1 {
+		message = api.Message{Role: "assistant", ToolCalls: []api.ToolCall{{Function: api.ToolCallFunction{
+			Name:      "read-file",
+			Arguments: api.ToolCallFunctionArguments{llm.InvalidArgumentsKey: "the arguments are not valid JSON"},
+		}}}}
+	}
+
+	return fn(api.ChatResponse{Message: message, Done: true})
+}
+
+func TestChatWithToolsReportsInvalidArguments(t *testing.T) {
+	a := NewAgent(config.EngineOpenAI, config.Server{}, config.Agent{Name: "backend-developer"})
+	a.Client = &invalidArgumentsClient{}
+
+	resp, err := a.ChatWithTools(context.Background(), "build the server", func(ctx context.Context, name string, args map[string]any) (string, error) {
+		t.Errorf("expected %s not to be executed", name)
+
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Message != "done" {
+		t.Fatalf("expected the model to answer after the error, got %q", resp.Message)
+	}
+
+	history := a.History()
+	if result := history[len(history)-2]; result.Role != "tool" || !strings.Contains(result.Content, "not valid JSON") {
+		t.Fatalf("expected the problem to be reported as the tool result, got %+v", result)
+	}
+}
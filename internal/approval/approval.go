@@ -0,0 +1,219 @@
+// Package approval decides whether the commands requested by agents can be
+// executed, either from configured rules or by asking an approver.
+package approval
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+	ActionAsk   Action = "ask"
+)
+
+type Request struct {
+	Agent            string   `json:"agent"`
+	Command          string   `json:"command"`
+	Argv             []string `json:"argv"`
+	Shell            bool     `json:"shell"`
+	WorkingDirectory string   `json:"working_directory"`
+}
+
+type Decision struct {
+	Approved bool
+	Reason   string
+}
+
+// Approver is asked about commands that no rule allows or denies outright.
+type Approver interface {
+	Approve(ctx context.Context, req Request) (Decision, error)
+}
+
+type rule struct {
+	action Action
+	prefix string
+	regex  *regexp.Regexp
+	agents []string
+}
+
+func (r rule) matches(agent string, command string) bool {
+	if len(r.agents) > 0 && !slices.Contains(r.agents, agent) {
+		return false
+	}
+
+	if r.prefix != "" && !hasCommandPrefix(command, r.prefix) {
+		return false
+	}
+
+	if r.regex != nil && !r.regex.MatchString(command) {
+		return false
+	}
+
+	return true
+}
+
+type Policy struct {
+	rules               []rule
+	defaultAction       Action
+	autoApproveReadOnly bool
+	alwaysAskDangerous  bool
+	approver            Approver
+}
+
+func NewPolicy(cfg config.Approval) (*Policy, error) {
+	p := &Policy{
+		defaultAction:       ActionAsk,
+		autoApproveReadOnly: cfg.AutoApproveReadOnly,
+		alwaysAskDangerous:  cfg.AlwaysAskDangerous,
+	}
+
+	if cfg.Default != "" {
+		action, err := parseAction(cfg.Default)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default approval action: %w", err)
+		}
+
+		p.defaultAction = action
+	}
+
+	for i, r := range cfg.Rules {
+		action, err := parseAction(r.Action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid approval rule %d: %w", i, err)
+		}
+
+		if r.Prefix == "" && r.Regex == "" {
+			return nil, fmt.Errorf("invalid approval rule %d: prefix or regex is required", i)
+		}
+
+		compiled := rule{
+			action: action,
+			prefix: r.Prefix,
+			agents: r.Agents,
+		}
+
+		if r.Regex != "" {
+			compiled.regex, err = regexp.Compile(r.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid approval rule %d: %w", i, err)
+			}
+		}
+
+		p.rules = append(p.rules, compiled)
+	}
+
+	approver, err := NewApprover(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p.approver = approver
+
+	return p, nil
+}
+
+// Evaluate decides on the request. Shell commands are split into their
+// pipeline and list segments, and the most restrictive outcome among them
+// wins, so "ls && rm -rf src" is not approved as a read-only command.
+func (p *Policy) Evaluate(ctx context.Context, req Request) (Decision, error) {
+	segments := []string{req.Command}
+	if req.Shell {
+		segments = splitShellSegments(req.Command)
+	}
+
+	action := ActionAllow
+	reason := ""
+
+	for i, segment := range segments {
+		segmentAction, segmentReason := p.evaluateSegment(req.Agent, segment, req.Shell)
+
+		if i == 0 || restrictiveness(segmentAction) > restrictiveness(action) {
+			action = segmentAction
+			reason = segmentReason
+		}
+	}
+
+	switch action {
+	case ActionAllow:
+		slog.Info("Command approved by policy", "agent", req.Agent, "command", req.Command, "reason", reason)
+
+		return Decision{Approved: true, Reason: reason}, nil
+	case ActionDeny:
+		slog.Warn("Command denied by policy", "agent", req.Agent, "command", req.Command, "reason", reason)
+
+		return Decision{Approved: false, Reason: reason}, nil
+	}
+
+	decision, err := p.approver.Approve(ctx, req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("error asking for approval: %w", err)
+	}
+
+	return decision, nil
+}
+
+func (p *Policy) evaluateSegment(agent string, segment string, shell bool) (Action, string) {
+	segment = strings.TrimSpace(segment)
+
+	for _, r := range p.rules {
+		if r.action == ActionDeny && r.matches(agent, segment) {
+			return ActionDeny, "matched a deny rule"
+		}
+	}
+
+	// Rules only look at the command words, which say nothing about what
+	// the shell runs or writes besides them
+	if shell && hasShellConstructs(segment) {
+		if p.defaultAction == ActionDeny {
+			return ActionDeny, "shell redirection, substitution or grouping"
+		}
+
+		return ActionAsk, "shell redirection, substitution or grouping"
+	}
+
+	if p.alwaysAskDangerous && isDangerous(segment) {
+		return ActionAsk, "destructive or network command"
+	}
+
+	for _, r := range p.rules {
+		if r.matches(agent, segment) {
+			return r.action, fmt.Sprintf("matched an %s rule", r.action)
+		}
+	}
+
+	if p.autoApproveReadOnly && isReadOnly(segment) {
+		return ActionAllow, "read-only command"
+	}
+
+	return p.defaultAction, "default action"
+}
+
+func parseAction(action string) (Action, error) {
+	switch Action(action) {
+	case ActionAllow, ActionDeny, ActionAsk:
+		return Action(action), nil
+	default:
+		return "", fmt.Errorf("unknown action %q, expected allow, deny or ask", action)
+	}
+}
+
+func restrictiveness(action Action) int {
+	switch action {
+	case ActionDeny:
+		return 2
+	case ActionAsk:
+		return 1
+	default:
+		return 0
+	}
+}
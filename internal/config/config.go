@@ -1,16 +1,104 @@
 package config
 
+import "time"
+
 type Config struct {
-	Engine string  `yaml:"engine"`
-	Goal   string  `yaml:"goal"`
-	Agents []Agent `yaml:"agents"`
+	Engine          string         `yaml:"engine"`
+	Server          Server         `yaml:"server,omitempty"`
+	Goal            string         `yaml:"goal"`
+	Manager         string         `yaml:"manager,omitempty"`
+	MaxReviews      int            `yaml:"max_reviews,omitempty"`
+	ReportToManager bool           `yaml:"report_to_manager,omitempty"`
+	MaxConcurrency  int            `yaml:"max_concurrency,omitempty"`
+	Retry           *RetryPolicy   `yaml:"retry,omitempty"`
+	Commands        Commands       `yaml:"commands,omitempty"`
+	Approval        Approval       `yaml:"approval,omitempty"`
+	Tools           []ExternalTool `yaml:"tools,omitempty"`
+	Agents          []Agent        `yaml:"agents"`
+}
+
+const DefaultManager = "project-manager"
+
+// The supported inference engines. "openai" attaches to any server exposing
+// the OpenAI /v1/chat/completions API, such as vLLM, LM Studio or LocalAI.
+const (
+	EngineOllama   = "ollama"
+	EngineLlamaCpp = "llama-cpp"
+	EngineOpenAI   = "openai"
+)
+
+// Server configures the inference server of the engine. Binary and Args
+// override the executable and add flags for spawned servers, URL and APIKey
+// point to a server that is already running. PullModels downloads the models
+// of the agents missing from the server, where the engine supports it.
+// ReadyTimeout and ReadyPollInterval control how long and how often a spawned
+// server is checked until it is ready, defaulting per engine.
+type Server struct {
+	URL               string        `yaml:"url,omitempty"`
+	APIKey            string        `yaml:"api_key,omitempty"`
+	Binary            string        `yaml:"binary,omitempty"`
+	Args              []string      `yaml:"args,omitempty"`
+	PullModels        bool          `yaml:"pull_models,omitempty"`
+	ReadyTimeout      time.Duration `yaml:"ready_timeout,omitempty"`
+	ReadyPollInterval time.Duration `yaml:"ready_poll_interval,omitempty"`
+}
+
+// RetryPolicy controls how failed tasks are retried. Retryable lists the
+// error classes that trigger a retry: "transient" (engine unreachable or
+// overloaded), "step_limit" (the agent ran out of tool steps) and "other".
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts,omitempty"`
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+	Retryable      []string      `yaml:"retryable,omitempty"`
+}
+
+// Commands configures how run-command executes processes.
+type Commands struct {
+	Timeout        time.Duration     `yaml:"timeout,omitempty"`
+	MaxOutputBytes int               `yaml:"max_output_bytes,omitempty"`
+	Shell          string            `yaml:"shell,omitempty"`
+	Env            map[string]string `yaml:"env,omitempty"`
+}
+
+// Approval configures which commands agents may run without asking. Rules
+// are matched by command prefix or regex and optionally restricted to some
+// agents; commands matching no rule fall back to Default.
+type Approval struct {
+	Approver            string         `yaml:"approver,omitempty"`
+	URL                 string         `yaml:"url,omitempty"`
+	Timeout             time.Duration  `yaml:"timeout,omitempty"`
+	Default             string         `yaml:"default,omitempty"`
+	AutoApproveReadOnly bool           `yaml:"auto_approve_read_only,omitempty"`
+	AlwaysAskDangerous  bool           `yaml:"always_ask_dangerous,omitempty"`
+	Rules               []ApprovalRule `yaml:"rules,omitempty"`
+}
+
+type ApprovalRule struct {
+	Action string   `yaml:"action"`
+	Prefix string   `yaml:"prefix,omitempty"`
+	Regex  string   `yaml:"regex,omitempty"`
+	Agents []string `yaml:"agents,omitempty"`
+}
+
+// ExternalTool is a tool implemented by an executable, receiving the JSON
+// arguments on stdin, or by an HTTP endpoint, receiving them as the POST
+// body. Both answer with {"result": string, "error": string}.
+type ExternalTool struct {
+	Name    string        `yaml:"name"`
+	Command []string      `yaml:"command,omitempty"`
+	URL     string        `yaml:"url,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
 }
 
 type Agent struct {
-	Name   string `yaml:"name"`
-	Model  string `yaml:"model"`
-	Prompt string `yaml:"prompt"`
-	Tools  []Tool `yaml:"tools"`
+	Name         string       `yaml:"name"`
+	Model        string       `yaml:"model"`
+	Prompt       string       `yaml:"prompt"`
+	MaxToolSteps int          `yaml:"max_tool_steps,omitempty"`
+	Concurrency  int          `yaml:"concurrency,omitempty"`
+	Retry        *RetryPolicy `yaml:"retry,omitempty"`
+	Tools        []Tool       `yaml:"tools"`
 }
 
 type Tool struct {
@@ -0,0 +1,44 @@
+// Package llm abstracts the chat APIs of the supported inference engines
+// behind the request and response types of the ollama API.
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/ollama/ollama/api"
+)
+
+// Client is the chat API an agent talks to. Tool calls are reported in the
+// same shape whatever the engine.
+type Client interface {
+	Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error
+}
+
+// NewClient returns the client speaking the API of the engine served at u.
+func NewClient(engine string, u *url.URL, apiKey string) (Client, error) {
+	switch engine {
+	case config.EngineOllama:
+		return &OllamaClient{Client: api.NewClient(u, http.DefaultClient)}, nil
+	case config.EngineLlamaCpp:
+		// llama-server serves the model it was started with, whatever the
+		// name in the request, so there is nothing to check
+		return &chatClient{NewOpenAIClient(u, apiKey)}, nil
+	case config.EngineOpenAI:
+		return NewOpenAIClient(u, apiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q", engine)
+	}
+}
+
+// chatClient exposes only the chat API of a client.
+type chatClient struct {
+	client Client
+}
+
+func (c *chatClient) Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	return c.client.Chat(ctx, req, fn)
+}
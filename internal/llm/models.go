@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var ErrModelNotFound = errors.New("model not found")
+
+// PullProgressFunc receives the progress of a model download, completed and
+// total are in bytes and zero for the steps that download nothing.
+type PullProgressFunc func(status string, completed, total int64)
+
+// ModelChecker is implemented by the clients able to tell whether a model is
+// available on the server.
+type ModelChecker interface {
+	HasModel(ctx context.Context, model string) (bool, error)
+}
+
+// ModelPuller is implemented by the clients able to download models.
+type ModelPuller interface {
+	PullModel(ctx context.Context, model string, progress PullProgressFunc) error
+}
+
+// EnsureModel checks that the model is available on the server of the
+// client, pulling it when pull is set and the engine supports it. Clients
+// that can't list their models are assumed to serve it.
+func EnsureModel(ctx context.Context, client Client, model string, pull bool) error {
+	checker, ok := client.(ModelChecker)
+	if !ok {
+		return nil
+	}
+
+	found, err := checker.HasModel(ctx, model)
+	if err != nil {
+		return fmt.Errorf("error checking model %q: %w", model, err)
+	}
+
+	if found {
+		return nil
+	}
+
+	puller, ok := client.(ModelPuller)
+	if !ok {
+		return fmt.Errorf("%w: %q is not served by the server", ErrModelNotFound, model)
+	}
+
+	if !pull {
+		return fmt.Errorf("%w: %q is not available locally, pull it or set server.pull_models", ErrModelNotFound, model)
+	}
+
+	slog.Info("Pulling model", "model", model)
+
+	if err := puller.PullModel(ctx, model, logPullProgress(model)); err != nil {
+		return fmt.Errorf("error pulling model %q: %w", model, err)
+	}
+
+	slog.Info("Model pulled", "model", model)
+
+	return nil
+}
+
+// logPullProgress logs every change of status and every 10% of a download.
+func logPullProgress(model string) PullProgressFunc {
+	lastStatus := ""
+	lastPercent := int64(-1)
+
+	return func(status string, completed, total int64) {
+		if total <= 0 {
+			if status != lastStatus {
+				slog.Info("Pulling model", "model", model, "status", status)
+			}
+
+			lastStatus = status
+
+			return
+		}
+
+		percent := completed * 100 / total / 10 * 10
+		if status == lastStatus && percent == lastPercent {
+			return
+		}
+
+		lastStatus = status
+		lastPercent = percent
+
+		slog.Info("Pulling model", "model", model, "status", status, "progress", fmt.Sprintf("%d%%", percent))
+	}
+}
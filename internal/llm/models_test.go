@@ -0,0 +1,180 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// ollamaServer stands in for ollama, serving the models in models and
+// adding the pulled ones. status replaces every answer when set.
+type ollamaServer struct {
+	mu     sync.Mutex
+	models map[string]bool
+	pulls  int
+	status int
+}
+
+func (s *ollamaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status != 0 {
+		http.Error(w, `{"error":"internal error"}`, s.status)
+
+		return
+	}
+
+	var req struct {
+		Model string `json:"model"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"bad request"}`, http.StatusBadRequest)
+
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/show":
+		if !s.models[req.Model] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":"model '%s' not found"}`, req.Model)
+
+			return
+		}
+
+		fmt.Fprint(w, `{}`)
+	case "/api/pull":
+		s.pulls++
+		s.models[req.Model] = true
+
+		fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		fmt.Fprintln(w, `{"status":"pulling abc","total":100,"completed":50}`)
+		fmt.Fprintln(w, `{"status":"pulling abc","total":100,"completed":100}`)
+		fmt.Fprintln(w, `{"status":"success"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(t *testing.T, engine string, handler http.Handler) Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(engine, u, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestEnsureModelOllama(t *testing.T) {
+	tests := []struct {
+		name     string
+		models   map[string]bool
+		pull     bool
+		status   int
+		pulls    int
+		notFound bool
+		fails    bool
+	}{
+		{name: "found", models: map[string]bool{"gemma3": true}},
+		{name: "missing", models: map[string]bool{}, notFound: true, fails: true},
+		{name: "missing and pull", models: map[string]bool{}, pull: true, pulls: 1},
+		{name: "server error", models: map[string]bool{}, status: http.StatusInternalServerError, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &ollamaServer{models: test.models, status: test.status}
+			client := newTestClient(t, config.EngineOllama, server)
+
+			err := EnsureModel(context.Background(), client, "gemma3", test.pull)
+
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure to be %v, got %v", test.fails, err)
+			}
+
+			if test.notFound != errors.Is(err, ErrModelNotFound) {
+				t.Fatalf("expected not found to be %v, got %v", test.notFound, err)
+			}
+
+			if server.pulls != test.pulls {
+				t.Fatalf("expected %d pulls, got %d", test.pulls, server.pulls)
+			}
+		})
+	}
+}
+
+func TestEnsureModelOpenAI(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		pull     bool
+		notFound bool
+		fails    bool
+		model    string
+	}{
+		{name: "found", model: "qwen3"},
+		{name: "missing", model: "llama3", notFound: true, fails: true},
+		{name: "missing and pull", model: "llama3", pull: true, notFound: true, fails: true},
+		{name: "server error", model: "qwen3", status: http.StatusInternalServerError, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(t, config.EngineOpenAI, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/models" {
+					http.NotFound(w, r)
+
+					return
+				}
+
+				if test.status != 0 {
+					http.Error(w, `{"error":{"message":"internal error"}}`, test.status)
+
+					return
+				}
+
+				fmt.Fprint(w, `{"object":"list","data":[{"id":"qwen3","object":"model"}]}`)
+			}))
+
+			err := EnsureModel(context.Background(), client, test.model, test.pull)
+
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure to be %v, got %v", test.fails, err)
+			}
+
+			if test.notFound != errors.Is(err, ErrModelNotFound) {
+				t.Fatalf("expected not found to be %v, got %v", test.notFound, err)
+			}
+		})
+	}
+}
+
+func TestEnsureModelLlamaCppSkipsCheck(t *testing.T) {
+	client := newTestClient(t, config.EngineLlamaCpp, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	}))
+
+	if err := EnsureModel(context.Background(), client, "model.gguf", false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,37 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ollama/ollama/api"
+)
+
+// OllamaClient is the ollama API client, able to check and pull models.
+type OllamaClient struct {
+	*api.Client
+}
+
+func (c *OllamaClient) HasModel(ctx context.Context, model string) (bool, error) {
+	_, err := c.Show(ctx, &api.ShowRequest{Model: model})
+
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *OllamaClient) PullModel(ctx context.Context, model string, progress PullProgressFunc) error {
+	return c.Pull(ctx, &api.PullRequest{Model: model}, func(resp api.ProgressResponse) error {
+		progress(resp.Status, resp.Completed, resp.Total)
+
+		return nil
+	})
+}
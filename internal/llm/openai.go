@@ -0,0 +1,294 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/ollama/ollama/api"
+)
+
+// maxResponseBytes bounds the responses read from the server, far above
+// any real completion.
+const maxResponseBytes = 32 << 20
+
+// InvalidArgumentsKey replaces the arguments of a tool call the model sent
+// as invalid JSON. Its value describes the problem.
+const InvalidArgumentsKey = "__invalid_arguments"
+
+// OpenAIClient talks to any server implementing the OpenAI
+// /v1/chat/completions API, such as llama.cpp, vLLM, LM Studio or LocalAI.
+type OpenAIClient struct {
+	base   *url.URL
+	apiKey string
+	http   *http.Client
+}
+
+func NewOpenAIClient(base *url.URL, apiKey string) *OpenAIClient {
+	return &OpenAIClient{
+		base:   base,
+		apiKey: apiKey,
+		http:   http.DefaultClient,
+	}
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+type openAIRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// Chat sends a non streaming completion request and reports the whole
+// answer to fn in a single response.
+func (c *OpenAIClient) Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	body, err := json.Marshal(openAIRequest{
+		Model:    req.Model,
+		Messages: toOpenAIMessages(req.Messages),
+		Tools:    toOpenAITools(req.Tools),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding request: %w", err)
+	}
+
+	var response openAIResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body), &response); err != nil {
+		return err
+	}
+
+	if len(response.Choices) == 0 {
+		return fmt.Errorf("the server returned no choices")
+	}
+
+	choice := response.Choices[0]
+
+	message := api.Message{
+		Role:    "assistant",
+		Content: choice.Message.Content,
+	}
+
+	for _, call := range choice.Message.ToolCalls {
+		arguments := api.ToolCallFunctionArguments{}
+
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+				// Reported to the model as the result of the call, so it can
+				// send it again
+				arguments = api.ToolCallFunctionArguments{
+					InvalidArgumentsKey: fmt.Sprintf("the arguments are not valid JSON (%s): %s", err, call.Function.Arguments),
+				}
+			}
+		}
+
+		message.ToolCalls = append(message.ToolCalls, api.ToolCall{
+			Function: api.ToolCallFunction{
+				Name:      call.Function.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+
+	return fn(api.ChatResponse{
+		Model:      response.Model,
+		Message:    message,
+		DoneReason: choice.FinishReason,
+		Done:       true,
+	})
+}
+
+// HasModel looks for the model among the ones listed by the server.
+func (c *OpenAIClient) HasModel(ctx context.Context, model string) (bool, error) {
+	var response struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/v1/models", nil, &response); err != nil {
+		return false, err
+	}
+
+	for _, m := range response.Data {
+		if m.ID == model {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (c *OpenAIClient) do(ctx context.Context, method string, path string, body io.Reader, response any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base.JoinPath(path).String(), body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return err
+	}
+
+	if len(data) > maxResponseBytes {
+		return fmt.Errorf("response from %s is larger than %d bytes", path, maxResponseBytes)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		// Reported like the ollama client does, so callers can tell
+		// transient server errors apart
+		statusErr := api.StatusError{
+			StatusCode:   resp.StatusCode,
+			Status:       resp.Status,
+			ErrorMessage: string(data),
+		}
+
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			statusErr.ErrorMessage = apiErr.Error.Message
+		}
+
+		return statusErr
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// toOpenAIMessages converts the history. The ollama messages don't carry
+// tool call IDs, so they are generated for every assistant tool call and
+// assigned in order to the tool messages answering it.
+func toOpenAIMessages(messages []api.Message) []openAIMessage {
+	converted := make([]openAIMessage, 0, len(messages))
+	pending := []string{}
+
+	for i, message := range messages {
+		m := openAIMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		}
+
+		switch message.Role {
+		case "assistant":
+			pending = pending[:0]
+
+			for j, call := range message.ToolCalls {
+				arguments, _ := json.Marshal(call.Function.Arguments) //nolint:errcheck
+
+				toolCall := openAIToolCall{
+					ID:   fmt.Sprintf("call_%d_%d", i, j),
+					Type: "function",
+				}
+				toolCall.Function.Name = call.Function.Name
+				toolCall.Function.Arguments = string(arguments)
+
+				m.ToolCalls = append(m.ToolCalls, toolCall)
+				pending = append(pending, toolCall.ID)
+			}
+		case "tool":
+			if len(pending) > 0 {
+				m.ToolCallID = pending[0]
+				pending = pending[1:]
+			}
+		}
+
+		converted = append(converted, m)
+	}
+
+	return converted
+}
+
+func toOpenAITools(tools api.Tools) []openAITool {
+	converted := make([]openAITool, 0, len(tools))
+
+	for _, tool := range tools {
+		var parameters map[string]any
+
+		data, err := json.Marshal(tool.Function.Parameters)
+		if err == nil {
+			_ = json.Unmarshal(data, &parameters) //nolint:errcheck
+		}
+
+		if parameters == nil {
+			parameters = map[string]any{}
+		}
+
+		if parameters["type"] == nil || parameters["type"] == "" {
+			parameters["type"] = "object"
+		}
+
+		// Some servers reject a null list of required parameters
+		if parameters["required"] == nil {
+			parameters["required"] = []string{}
+		}
+
+		t := openAITool{Type: "function"}
+		t.Function.Name = tool.Function.Name
+		t.Function.Description = tool.Function.Description
+		t.Function.Parameters = parameters
+
+		converted = append(converted, t)
+	}
+
+	return converted
+}
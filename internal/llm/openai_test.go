@@ -0,0 +1,58 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/ollama/ollama/api"
+)
+
+func TestOpenAIResponseSizeIsLimited(t *testing.T) {
+	client := newTestClient(t, config.EngineOpenAI, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := strings.Repeat("a", 1<<20)
+
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"`)) //nolint:errcheck
+
+		for range maxResponseBytes>>20 + 1 {
+			w.Write([]byte(chunk)) //nolint:errcheck
+		}
+
+		w.Write([]byte(`"}}]}`)) //nolint:errcheck
+	}))
+
+	err := client.Chat(context.Background(), &api.ChatRequest{Model: "qwen3"}, func(api.ChatResponse) error {
+		return nil
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("expected the response to be rejected, got %v", err)
+	}
+}
+
+func TestOpenAIInvalidToolArgumentsAreReported(t *testing.T) {
+	client := newTestClient(t, config.EngineOpenAI, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","tool_calls":[{"id":"1","type":"function","function":{"name":"read-file","arguments":"{\"file\": \"main.go\""}}]}}]}`)) //nolint:errcheck
+	}))
+
+	var calls []api.ToolCall
+
+	err := client.Chat(context.Background(), &api.ChatRequest{Model: "qwen3"}, func(response api.ChatResponse) error {
+		calls = append(calls, response.Message.ToolCalls...)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 1 || calls[0].Function.Name != "read-file" {
+		t.Fatalf("expected the read-file call, got %+v", calls)
+	}
+
+	if problem, _ := calls[0].Function.Arguments[InvalidArgumentsKey].(string); !strings.Contains(problem, "not valid JSON") {
+		t.Fatalf("expected the invalid arguments to be described, got %v", calls[0].Function.Arguments)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build linux
+
+package process
+
+import "syscall"
+
+// setParentDeathSignal has the kernel kill the child when this process dies
+// without stopping it, e.g. on SIGKILL or a crash. Only the child is killed:
+// SIGKILL can't be handled, so its own children keep running, reparented to
+// init. The signal is tied to the forking thread, see Start.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestStartSurvivesCallingThreadExit(t *testing.T) {
+	type child struct {
+		cmd  *exec.Cmd
+		done <-chan error
+		err  error
+	}
+
+	// Several children, since the runtime never ends the main thread and
+	// one of the goroutines may run on it
+	var children []child
+
+	for range 3 {
+		cmd := exec.Command("sleep", "10")
+		Group(cmd)
+
+		started := make(chan child, 1)
+
+		// Locked and never unlocked, so the thread exits with the goroutine
+		go func() {
+			runtime.LockOSThread()
+
+			done, err := Start(cmd)
+			started <- child{cmd: cmd, done: done, err: err}
+		}()
+
+		c := <-started
+		if c.err != nil {
+			t.Fatal(c.err)
+		}
+
+		children = append(children, c)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	for _, c := range children {
+		select {
+		case err := <-c.done:
+			t.Errorf("expected the child to be running, it exited with %v", err)
+		default:
+			_ = KillGroup(c.cmd)
+			<-c.done
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package process contains helpers to manage child processes and the
+// process groups they spawn.
+//
+// Stopping a group takes this process to be alive, which covers returning,
+// failing and the signals it handles. When it is killed with SIGKILL or
+// crashes, Linux kills the direct children only, see Group: whatever they
+// started themselves, like the server run by "sh -c 'npm start'" or the
+// runners of an inference server, keeps running.
+package process
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// killWait bounds the wait for a process to exit once killed.
+const killWait = 5 * time.Second
+
+// Isolate starts cmd in its own process group and makes cancelling its
+// context kill the whole group, so no grandchildren are left behind when it
+// is cancelled.
+func Isolate(cmd *exec.Cmd) {
+	Group(cmd)
+
+	cmd.Cancel = func() error {
+		return KillGroup(cmd)
+	}
+}
+
+// Group starts cmd in its own process group, so it doesn't receive the
+// signals sent to the terminal and the group can be stopped as a whole.
+// On Linux the process, but not its own children, is also killed if this
+// one dies without stopping it, as long as it is started with Start or Run.
+func Group(cmd *exec.Cmd) {
+	setProcessGroup(cmd)
+}
+
+// Start starts cmd and waits for it in the background, returning the
+// channel receiving the result of Wait.
+//
+// Linux sends the parent death signal when the thread that forked the child
+// exits, not the whole process, and the Go runtime ends threads at will. So
+// the child is started and waited for on a locked thread, which lives as
+// long as the child does.
+func Start(cmd *exec.Cmd) (<-chan error, error) {
+	started := make(chan error, 1)
+	done := make(chan error, 1)
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		if err := cmd.Start(); err != nil {
+			started <- err
+
+			return
+		}
+
+		started <- nil
+		done <- cmd.Wait()
+	}()
+
+	if err := <-started; err != nil {
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// Run starts cmd like Start and waits for it to complete.
+func Run(cmd *exec.Cmd) error {
+	done, err := Start(cmd)
+	if err != nil {
+		return err
+	}
+
+	return <-done
+}
+
+// KillGroup kills the process group led by cmd, falling back to the process
+// alone when groups are not supported.
+func KillGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	return killGroup(cmd)
+}
+
+// Terminate asks the process group led by cmd to exit and waits for exited
+// to be closed, killing the group once ctx is done. The group is killed in
+// any case once the leader exits, so none of its children outlive it.
+func Terminate(ctx context.Context, cmd *exec.Cmd, exited <-chan struct{}) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	if exited == nil {
+		return KillGroup(cmd)
+	}
+
+	if err := interruptGroup(cmd); err != nil {
+		return KillGroup(cmd)
+	}
+
+	select {
+	case <-exited:
+		return KillGroup(cmd)
+	case <-ctx.Done():
+	}
+
+	if err := KillGroup(cmd); err != nil {
+		return err
+	}
+
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(killWait):
+		return context.DeadlineExceeded
+	}
+}
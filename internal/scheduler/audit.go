@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+const maxAuditValueSize = 200
+
+// PermissionError is returned when an agent calls a tool it wasn't granted.
+type PermissionError struct {
+	Agent string
+	Tool  string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("agent %s is not allowed to use tool %s, only the tools listed in your instructions are available", e.Agent, e.Tool)
+}
+
+// audit logs one line per tool call with the agent, the tool, the
+// arguments and the outcome. Long argument values, like file contents, are
+// shortened.
+func (t *ToolCaller) audit(agentName string, toolName string, args map[string]any, err error) {
+	arguments := shortenArguments(args)
+
+	var (
+		permissionErr *PermissionError
+		validationErr *ValidationError
+	)
+
+	switch {
+	case err == nil:
+		slog.Info("Tool call", "agent", agentName, "tool", toolName, "arguments", arguments, "outcome", "success")
+	case errors.As(err, &permissionErr):
+		slog.Warn("Tool call", "agent", agentName, "tool", toolName, "arguments", arguments, "outcome", "denied", "error", err)
+	case errors.As(err, &validationErr):
+		slog.Warn("Tool call", "agent", agentName, "tool", toolName, "arguments", arguments, "outcome", "invalid", "error", err)
+	default:
+		slog.Warn("Tool call", "agent", agentName, "tool", toolName, "arguments", arguments, "outcome", "error", "error", err)
+	}
+}
+
+// shortenArguments returns a copy of args with the long string values, like
+// file contents, shortened.
+func shortenArguments(args map[string]any) map[string]any {
+	arguments := make(map[string]any, len(args))
+	for name, value := range args {
+		if s, ok := value.(string); ok {
+			value = shorten(s)
+		}
+
+		arguments[name] = value
+	}
+
+	return arguments
+}
+
+func shorten(s string) string {
+	if len(s) <= maxAuditValueSize {
+		return s
+	}
+
+	return fmt.Sprintf("%s... (%d bytes)", s[:maxAuditValueSize], len(s))
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// GoalCompleteMarker is the phrase the manager must reply with, alone,
+// during a review to declare the goal met.
+const GoalCompleteMarker = "GOAL COMPLETE"
+
+var (
+	ErrTasksFailed = errors.New("one or more tasks failed")
+	ErrGoalNotMet  = errors.New("the manager did not declare the goal complete")
+)
+
+// isQuiescent reports whether nothing is running and nothing is left to
+// schedule. It must be called with t.mu held.
+func (t *TaskScheduler) isQuiescent() bool {
+	if t.inFlight > 0 || len(t.pendingReports) > 0 {
+		return false
+	}
+
+	for _, task := range t.Tasks {
+		if isRunnable(task) || task.Status == TaskStatusInProgress {
+			return false
+		}
+	}
+
+	return true
+}
+
+// review hands a summary of the tasks to the manager, which can either
+// declare the goal complete or assign more tasks. It reports whether new
+// tasks were created.
+func (t *TaskScheduler) review() (bool, error) {
+	manager, ok := t.Agents[t.Manager]
+	if !ok {
+		return false, fmt.Errorf("manager agent %s not found", t.Manager)
+	}
+
+	t.reviews++
+
+	tasks := t.GetTasks()
+
+	var summary strings.Builder
+	summary.WriteString("All the assigned tasks have finished. This is their outcome:\n\n")
+
+	for _, task := range tasks {
+		fmt.Fprintf(&summary, "- [%s] %s (assigned to %s, id %s)", task.Status, task.Description, task.AssignedTo, task.ID)
+
+		if task.Error != "" {
+			fmt.Fprintf(&summary, ": %s", task.Error)
+		}
+
+		summary.WriteString("\n")
+	}
+
+	fmt.Fprintf(&summary, "\nIf the goal has been reached reply with exactly %q and nothing else. Otherwise assign the tasks needed to reach it.", GoalCompleteMarker)
+
+	slog.Info("Asking the manager to review the tasks", "manager", t.Manager, "review", t.reviews)
+
+	resp, err := manager.ChatWithTools(t.ctx, summary.String(), t.ToolExecutor(t.Manager))
+	if err != nil {
+		return false, fmt.Errorf("error reviewing tasks: %w", err)
+	}
+
+	created := len(t.GetTasks()) > len(tasks)
+
+	t.mu.Lock()
+	// New tasks mean the goal isn't met yet, whatever the reply says
+	t.goalComplete = !created && isGoalComplete(resp.Message)
+	t.mu.Unlock()
+
+	return created, nil
+}
+
+// isGoalComplete reports whether the reply is the marker alone, so replies
+// that merely mention it, like "GOAL COMPLETE once the tests pass", don't
+// end the run. Surrounding quotes, emphasis and punctuation are ignored.
+func isGoalComplete(reply string) bool {
+	return strings.EqualFold(strings.Trim(reply, " \t\r\n.!\"'`*"), GoalCompleteMarker)
+}
+
+// outcome returns nil if the run succeeded, or the reason it didn't.
+func (t *TaskScheduler) outcome() error {
+	if t.MaxReviews > 0 {
+		t.mu.Lock()
+		goalComplete := t.goalComplete
+		t.mu.Unlock()
+
+		if !goalComplete {
+			return ErrGoalNotMet
+		}
+
+		return nil
+	}
+
+	for _, task := range t.GetTasks() {
+		if task.Status == TaskStatusFailed {
+			return ErrTasksFailed
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsGoalComplete(t *testing.T) {
+	tests := []struct {
+		reply    string
+		complete bool
+	}{
+		{reply: "GOAL COMPLETE", complete: true},
+		{reply: "goal complete", complete: true},
+		{reply: "  GOAL COMPLETE.\n", complete: true},
+		{reply: `"GOAL COMPLETE"`, complete: true},
+		{reply: "**GOAL COMPLETE**", complete: true},
+		{reply: "The goal is not complete yet"},
+		{reply: "NOT GOAL COMPLETE"},
+		{reply: "GOAL COMPLETE once the frontend builds"},
+		{reply: "I assigned the missing tasks, the goal will be complete after them"},
+		{reply: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.reply, func(t *testing.T) {
+			if complete := isGoalComplete(test.reply); complete != test.complete {
+				t.Fatalf("expected goal complete to be %v, got %v", test.complete, complete)
+			}
+		})
+	}
+}
+
+func TestAddTaskClearsGoalComplete(t *testing.T) {
+	scheduler := NewTaskScheduler(t.Context(), nil, t.TempDir())
+	scheduler.MaxReviews = 1
+	scheduler.goalComplete = true
+
+	if err := scheduler.AddTask(&Task{Description: "fix the build"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.outcome(); !errors.Is(err, ErrGoalNotMet) {
+		t.Fatalf("expected the goal not to be met once tasks are added, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package scheduler
+
+import "context"
+
+type agentNameKey struct{}
+
+// withAgentName marks ctx as belonging to a tool call of the given agent.
+func withAgentName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, agentNameKey{}, name)
+}
+
+func agentNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(agentNameKey{}).(string)
+
+	return name
+}
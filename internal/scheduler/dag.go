@@ -0,0 +1,94 @@
+package scheduler
+
+// dependencyState reports whether all the dependencies of task completed, and
+// the first dependency that failed, if any. It must be called with t.mu held.
+func (t *TaskScheduler) dependencyState(task *Task) (bool, *Task) {
+	ready := true
+
+	for _, id := range task.DependsOn {
+		dependency := t.findTask(id)
+		if dependency == nil {
+			continue
+		}
+
+		switch dependency.Status {
+		case TaskStatusCompleted:
+		case TaskStatusFailed:
+			return false, dependency
+		default:
+			ready = false
+		}
+	}
+
+	return ready, nil
+}
+
+// findTask must be called with t.mu held.
+func (t *TaskScheduler) findTask(id string) *Task {
+	for _, task := range t.Tasks {
+		if task.ID == id {
+			return task
+		}
+	}
+
+	return nil
+}
+
+// findCycle returns the IDs of the tasks forming a dependency cycle, or nil
+// if the graph is acyclic.
+func findCycle(tasks []*Task) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	byID := make(map[string]*Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	state := make(map[string]int, len(tasks))
+	path := []string{}
+
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		switch state[id] {
+		case visiting:
+			for i, p := range path {
+				if p == id {
+					return append(append([]string(nil), path[i:]...), id)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		task, ok := byID[id]
+		if !ok {
+			return nil
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+
+		for _, dependency := range task.DependsOn {
+			if cycle := visit(dependency); cycle != nil {
+				return cycle
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[id] = visited
+
+		return nil
+	}
+
+	for _, task := range tasks {
+		if cycle := visit(task.ID); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks map[string][]string
+		cycle bool
+	}{
+		{name: "no dependencies", tasks: map[string][]string{"a": nil, "b": nil}},
+		{name: "chain", tasks: map[string][]string{"a": nil, "b": {"a"}, "c": {"b"}}},
+		{name: "diamond", tasks: map[string][]string{"a": nil, "b": {"a"}, "c": {"a"}, "d": {"b", "c"}}},
+		{name: "unknown dependency", tasks: map[string][]string{"a": {"missing"}}},
+		{name: "self", tasks: map[string][]string{"a": {"a"}}, cycle: true},
+		{name: "pair", tasks: map[string][]string{"a": {"b"}, "b": {"a"}}, cycle: true},
+		{name: "long", tasks: map[string][]string{"a": {"c"}, "b": {"a"}, "c": {"b"}, "d": nil}, cycle: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tasks := []*Task{}
+			for id, dependsOn := range test.tasks {
+				tasks = append(tasks, &Task{ID: id, DependsOn: dependsOn})
+			}
+
+			cycle := findCycle(tasks)
+
+			if !test.cycle {
+				if cycle != nil {
+					t.Fatalf("expected no cycle, got %v", cycle)
+				}
+
+				return
+			}
+
+			if len(cycle) < 2 || cycle[0] != cycle[len(cycle)-1] {
+				t.Fatalf("expected a closed cycle, got %v", cycle)
+			}
+
+			// Every step of the cycle must be a dependency
+			for i := 0; i < len(cycle)-1; i++ {
+				if !slices.Contains(test.tasks[cycle[i]], cycle[i+1]) {
+					t.Fatalf("%s does not depend on %s in cycle %v", cycle[i], cycle[i+1], cycle)
+				}
+			}
+		})
+	}
+}
+
+func TestAddTaskRejectsUnknownDependencies(t *testing.T) {
+	scheduler := NewTaskScheduler(t.Context(), nil, t.TempDir())
+
+	if err := scheduler.AddTask(&Task{Description: "a", DependsOn: []string{"missing"}}); err == nil {
+		t.Fatal("expected an unknown dependency to be rejected")
+	}
+
+	first := &Task{Description: "first"}
+	if err := scheduler.AddTask(first); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scheduler.AddTask(&Task{Description: "second", DependsOn: []string{first.ID}}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// replaceText replaces search with replacement in content. Unless all is
+// set, search must occur exactly once so the edit can't hit the wrong spot.
+func replaceText(content string, search string, replacement string, all bool) (string, int, error) {
+	if search == "" {
+		return "", 0, fmt.Errorf("search must not be empty")
+	}
+
+	count := strings.Count(content, search)
+
+	switch {
+	case count == 0:
+		return "", 0, fmt.Errorf("search text not found in the file, read the file again and copy the text exactly, including whitespace")
+	case count > 1 && !all:
+		return "", 0, fmt.Errorf("search text found %d times in the file, include more surrounding lines to make it unique or set replace_all", count)
+	}
+
+	return strings.ReplaceAll(content, search, replacement), count, nil
+}
+
+// replaceLines replaces the lines from start to end, both 1-based and
+// inclusive, with replacement.
+func replaceLines(content string, start int, end int, replacement string) (string, error) {
+	lines, trailingNewline := splitLines(content)
+
+	if start < 1 || end < start || end > len(lines) {
+		return "", fmt.Errorf("invalid line range %d-%d, the file has %d lines", start, end, len(lines))
+	}
+
+	replacementLines, _ := splitLines(replacement)
+
+	edited := append(append(append([]string{}, lines[:start-1]...), replacementLines...), lines[end:]...)
+
+	return joinLines(edited, trailingNewline), nil
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+type hunk struct {
+	header string
+	// index is the 0-based line the hunk applies at according to its header
+	index    int
+	oldLines []string
+	newLines []string
+}
+
+// applyUnifiedDiff applies the hunks of a unified diff to content. Hunks are
+// located by their context, starting from the line in their header, so
+// slightly wrong line numbers are tolerated but mismatching context is not.
+func applyUnifiedDiff(content string, patch string) (string, int, error) {
+	hunks, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return "", 0, err
+	}
+
+	lines, trailingNewline := splitLines(content)
+	offset := 0
+	from := 0
+
+	for i, h := range hunks {
+		position := findBlock(lines, h.oldLines, h.index+offset, from)
+		if position < 0 {
+			return "", 0, fmt.Errorf("hunk %d (%s) does not match the file: the lines to remove and the context lines must match the current content exactly, read the file again and regenerate the patch", i+1, h.header)
+		}
+
+		lines = append(append(append([]string{}, lines[:position]...), h.newLines...), lines[position+len(h.oldLines):]...)
+
+		offset += len(h.newLines) - len(h.oldLines)
+		from = position + len(h.newLines)
+	}
+
+	return joinLines(lines, trailingNewline), len(hunks), nil
+}
+
+func parseUnifiedDiff(patch string) ([]hunk, error) {
+	var hunks []hunk
+
+	var current *hunk
+
+	lines := strings.Split(strings.TrimRight(patch, "\n"), "\n")
+
+	for i, line := range lines {
+		if match := hunkHeader.FindStringSubmatch(line); match != nil {
+			index, _ := strconv.Atoi(match[1]) //nolint:errcheck
+
+			// A hunk that only adds lines refers to the line it inserts after
+			if match[2] != "0" {
+				index--
+			}
+
+			hunks = append(hunks, hunk{header: match[0], index: max(index, 0)})
+			current = &hunks[len(hunks)-1]
+
+			continue
+		}
+
+		// A "--- a/file" line followed by "+++ b/file" starts a new file
+		// header, not a removed line
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			current = nil
+		}
+
+		if current == nil {
+			// Skip the file headers and anything before the first hunk
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "-"):
+			current.oldLines = append(current.oldLines, line[1:])
+		case strings.HasPrefix(line, "+"):
+			current.newLines = append(current.newLines, line[1:])
+		case strings.HasPrefix(line, " "):
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+		case line == "":
+			// Editors and models often strip the space of empty context lines
+			current.oldLines = append(current.oldLines, "")
+			current.newLines = append(current.newLines, "")
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file"
+		default:
+			return nil, fmt.Errorf("invalid patch line %q, every line of a hunk must start with ' ', '-' or '+'", line)
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("the patch contains no hunks, expected a unified diff with @@ -start,count +start,count @@ headers")
+	}
+
+	return hunks, nil
+}
+
+// findBlock returns the index of block in lines at or after from, searching
+// outwards from hint, or -1 if it isn't found.
+func findBlock(lines []string, block []string, hint int, from int) int {
+	matches := func(position int) bool {
+		if position < from || position+len(block) > len(lines) {
+			return false
+		}
+
+		for i, line := range block {
+			if lines[position+i] != line {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	hint = max(hint, from)
+
+	for distance := 0; hint-distance >= from || hint+distance <= len(lines); distance++ {
+		if matches(hint - distance) {
+			return hint - distance
+		}
+
+		if matches(hint + distance) {
+			return hint + distance
+		}
+	}
+
+	return -1
+}
+
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return []string{}, false
+	}
+
+	trailingNewline := strings.HasSuffix(content, "\n")
+
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), trailingNewline
+}
+
+func joinLines(lines []string, trailingNewline bool) string {
+	content := strings.Join(lines, "\n")
+
+	if trailingNewline && len(lines) > 0 {
+		content += "\n"
+	}
+
+	return content
+}
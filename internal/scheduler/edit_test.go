@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const editContent = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		result string
+		hunks  int
+		fails  string
+	}{
+		{
+			name: "replace",
+			patch: `--- a/main.go
++++ b/main.go
+@@ -5,3 +5,3 @@
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
+ }
+`,
+			result: strings.Replace(editContent, `"hello"`, `"hello, world"`, 1),
+			hunks:  1,
+		},
+		{
+			name: "wrong line numbers",
+			patch: `@@ -1,3 +1,3 @@
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("bye")
+ }
+`,
+			result: strings.Replace(editContent, `"hello"`, `"bye"`, 1),
+			hunks:  1,
+		},
+		{
+			name: "stripped empty context line",
+			patch: `@@ -3,3 +3,4 @@
+ import "fmt"
+
++// main prints a greeting
+ func main() {
+`,
+			result: strings.Replace(editContent, "func main", "// main prints a greeting\nfunc main", 1),
+			hunks:  1,
+		},
+		{
+			name: "several hunks",
+			patch: `@@ -1,1 +1,1 @@
+-package main
++package hello
+@@ -6,1 +6,2 @@
+ 	fmt.Println("hello")
++	fmt.Println("world")
+`,
+			result: strings.Replace(strings.Replace(editContent, "package main", "package hello", 1), "\"hello\")\n", "\"hello\")\n\tfmt.Println(\"world\")\n", 1),
+			hunks:  2,
+		},
+		{
+			name: "insert at the start",
+			patch: `@@ -0,0 +1,1 @@
++// Command hello prints a greeting.
+`,
+			result: "// Command hello prints a greeting.\n" + editContent,
+			hunks:  1,
+		},
+		{
+			name: "mismatching context",
+			patch: `@@ -5,3 +5,3 @@
+ func main() {
+-	fmt.Println("goodbye")
++	fmt.Println("hello")
+ }
+`,
+			fails: "does not match the file",
+		},
+		{
+			name:  "no hunks",
+			patch: "just replace hello with world",
+			fails: "contains no hunks",
+		},
+		{
+			name: "invalid line",
+			patch: `@@ -1,1 +1,1 @@
+-package main
+package hello
+`,
+			fails: "invalid patch line",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, hunks, err := applyUnifiedDiff(editContent, test.patch)
+
+			if test.fails != "" {
+				if err == nil || !strings.Contains(err.Error(), test.fails) {
+					t.Fatalf("expected an error containing %q, got %v", test.fails, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != test.result {
+				t.Fatalf("expected\n%s\ngot\n%s", test.result, result)
+			}
+
+			if hunks != test.hunks {
+				t.Fatalf("expected %d hunks, got %d", test.hunks, hunks)
+			}
+		})
+	}
+}
+
+func TestEditFileRejectsNonStringArguments(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(editContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caller := NewTaskScheduler(t.Context(), nil, root).ToolCaller
+
+	for _, args := range []map[string]any{
+		{"file": "main.go", "search": 1.0, "replace": "x"},
+		{"file": "main.go", "search": "package main"},
+		{"file": "main.go", "search": "package main", "replace": 1.0},
+		{"file": "main.go", "patch": []any{"@@ -1 +1 @@"}},
+	} {
+		if _, err := caller.editFile(context.Background(), args); err == nil || !strings.Contains(err.Error(), "must be a string") {
+			t.Fatalf("expected %v to be rejected, got %v", args, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != editContent {
+		t.Fatalf("expected the file to be left unchanged, got %q", data)
+	}
+
+	// An explicit empty replacement still deletes
+	if _, err := caller.editFile(context.Background(), map[string]any{"file": "main.go", "search": "package main\n", "replace": ""}); err != nil {
+		t.Fatal(err)
+	}
+}
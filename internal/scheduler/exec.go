@@ -0,0 +1,249 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/process"
+)
+
+const (
+	defaultCommandTimeout = 10 * time.Minute
+	defaultMaxOutputBytes = 64 * 1024
+	defaultShell          = "/bin/sh"
+)
+
+type CommandRequest struct {
+	// Argv is executed directly, unless Shell is set in which case its only
+	// element is the script passed to the shell.
+	Argv    []string
+	Shell   bool
+	Dir     string
+	Timeout time.Duration
+}
+
+type CommandResult struct {
+	ExitCode  int
+	Output    string
+	Truncated bool
+	TimedOut  bool
+	Duration  time.Duration
+}
+
+func (r CommandResult) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "exit code: %d\n", r.ExitCode)
+	fmt.Fprintf(&b, "duration: %s\n", r.Duration.Round(time.Millisecond))
+
+	if r.TimedOut {
+		b.WriteString("the command timed out and was killed\n")
+	}
+
+	b.WriteString("output:\n")
+	b.WriteString(r.Output)
+
+	if r.Truncated {
+		b.WriteString("\n[output truncated]")
+	}
+
+	return b.String()
+}
+
+// runProcess executes the request in its own process group, capturing
+// stdout and stderr together up to the configured size. A non-zero exit code
+// is reported in the result, not as an error.
+func runProcess(ctx context.Context, settings config.Commands, req CommandRequest) (CommandResult, error) {
+	if len(req.Argv) == 0 {
+		return CommandResult{}, fmt.Errorf("command is empty")
+	}
+
+	// The configured timeout is also the limit for the requested one
+	timeout := settings.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	if req.Timeout > 0 && req.Timeout < timeout {
+		timeout = req.Timeout
+	}
+
+	maxOutput := settings.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = defaultMaxOutputBytes
+	}
+
+	argv := req.Argv
+	if req.Shell {
+		shell := settings.Shell
+		if shell == "" {
+			shell = defaultShell
+		}
+
+		if len(req.Argv) != 1 {
+			return CommandResult{}, fmt.Errorf("shell command must be a single script")
+		}
+
+		argv = []string{shell, "-c", req.Argv[0]}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output := &cappedBuffer{limit: maxOutput}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = req.Dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Env = os.Environ()
+	cmd.WaitDelay = 5 * time.Second
+
+	for key, value := range settings.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	process.Isolate(cmd)
+
+	start := time.Now()
+	err := process.Run(cmd)
+
+	result := CommandResult{
+		Output:    output.String(),
+		Truncated: output.truncated,
+		Duration:  time.Since(start),
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case result.TimedOut:
+		result.ExitCode = -1
+	default:
+		return result, fmt.Errorf("error running command: %w", err)
+	}
+
+	// A cancelled run is an interruption, not a command failure
+	if ctx.Err() != nil && !result.TimedOut {
+		return result, ctx.Err()
+	}
+
+	return result, nil
+}
+
+// splitCommand splits a command line into arguments, honouring single and
+// double quotes and backslash escapes the way a POSIX shell would.
+func splitCommand(command string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command %q", command)
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// shellJoin joins the arguments into a shell script running them as they
+// are, single quoting the ones the shell would otherwise interpret.
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+
+	if !strings.ContainsFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+	}) {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, remembering that it did.
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+		b.buf.Write(p[:max(remaining, 0)])
+		b.truncated = true
+
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
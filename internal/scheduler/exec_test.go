@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		fails   bool
+	}{
+		{command: "ls", args: []string{"ls"}},
+		{command: "  go   test\t./...\n", args: []string{"go", "test", "./..."}},
+		{command: `git commit -m "first commit"`, args: []string{"git", "commit", "-m", "first commit"}},
+		{command: `echo 'a "b" c'`, args: []string{"echo", `a "b" c`}},
+		{command: `echo "it's"`, args: []string{"echo", "it's"}},
+		{command: `echo a\ b`, args: []string{"echo", "a b"}},
+		{command: `echo "a \"b\""`, args: []string{"echo", `a "b"`}},
+		{command: `echo 'a\b'`, args: []string{"echo", `a\b`}},
+		{command: `echo "" ''`, args: []string{"echo", "", ""}},
+		{command: `echo pre"fix"post`, args: []string{"echo", "prefixpost"}},
+		{command: "", args: nil},
+		{command: `echo "unterminated`, fails: true},
+		{command: `echo 'unterminated`, fails: true},
+		{command: `echo trailing\`, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			args, err := splitCommand(test.command)
+
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", args)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(args, test.args) {
+				t.Fatalf("expected %q, got %q", test.args, args)
+			}
+		})
+	}
+}
+
+func TestShellJoinKeepsArguments(t *testing.T) {
+	argv := []string{"printf", "%s|", "a b", "it's", "$HOME", "", "x;y", "*"}
+
+	result, err := runProcess(context.Background(), config.Commands{}, CommandRequest{
+		Argv:  []string{shellJoin(argv)},
+		Shell: true,
+		Dir:   t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "a b|it's|$HOME||x;y|*|"; result.Output != expected {
+		t.Fatalf("expected %q, got %q", expected, result.Output)
+	}
+}
+
+func TestRunProcessCapsTimeout(t *testing.T) {
+	result, err := runProcess(context.Background(), config.Commands{Timeout: 100 * time.Millisecond}, CommandRequest{
+		Argv:    []string{"sleep", "5"},
+		Dir:     t.TempDir(),
+		Timeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.TimedOut || result.Duration > 4*time.Second {
+		t.Fatalf("expected the command to time out at the configured limit, got %+v", result)
+	}
+
+	if !strings.Contains(result.String(), "timed out") {
+		t.Fatalf("expected the result to report the timeout, got %q", result.String())
+	}
+}
@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/process"
+)
+
+const defaultExternalToolTimeout = 2 * time.Minute
+
+type externalToolResponse struct {
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+// CommandTool runs an executable from the workspace root, writing the
+// arguments as JSON on its stdin and reading the response from its stdout.
+type CommandTool struct {
+	caller  *ToolCaller
+	command []string
+	timeout time.Duration
+}
+
+// NewCommandTool resolves the executable of the tool once, relative paths
+// against configDir, so it can never be a file the agents wrote in the
+// workspace.
+func NewCommandTool(caller *ToolCaller, tool config.ExternalTool, configDir string) (*CommandTool, error) {
+	executable, err := resolveExecutable(tool.Command[0], configDir)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+
+	return &CommandTool{
+		caller:  caller,
+		command: append([]string{executable}, tool.Command[1:]...),
+		timeout: externalToolTimeout(tool),
+	}, nil
+}
+
+// resolveExecutable returns the absolute path of name: as is when absolute,
+// joined to dir when it is a relative path and looked up on PATH when it is
+// a bare name.
+func resolveExecutable(name string, dir string) (string, error) {
+	switch {
+	case filepath.IsAbs(name):
+		return name, nil
+	case strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator):
+		return filepath.Abs(filepath.Join(dir, name))
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("command %s not found: %w", name, err)
+	}
+
+	return filepath.Abs(path)
+}
+
+func (c *CommandTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	input, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("error encoding arguments: %w", err)
+	}
+
+	root, err := c.caller.workspaceRoot()
+	if err != nil {
+		return "", fmt.Errorf("error resolving workspace root: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{limit: defaultMaxOutputBytes}
+	stderr := &cappedBuffer{limit: defaultMaxOutputBytes}
+
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Dir = root
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = 5 * time.Second
+
+	process.Isolate(cmd)
+
+	if err := process.Run(cmd); err != nil {
+		return "", fmt.Errorf("error running %s: %w: %s", c.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return decodeExternalResponse([]byte(stdout.String()))
+}
+
+// HTTPTool posts the arguments as JSON to an endpoint and reads the
+// response from the body.
+type HTTPTool struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func NewHTTPTool(tool config.ExternalTool) *HTTPTool {
+	return &HTTPTool{
+		url:     tool.URL,
+		timeout: externalToolTimeout(tool),
+		client:  http.DefaultClient,
+	}
+}
+
+func (h *HTTPTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("error encoding arguments: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling %s: %w", h.url, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, defaultMaxOutputBytes))
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s returned %s: %s", h.url, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return decodeExternalResponse(data)
+}
+
+// decodeExternalResponse reads {"result": ..., "error": ...}, falling back
+// to the raw output for tools that don't answer with JSON.
+func decodeExternalResponse(data []byte) (string, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return string(data), nil
+	}
+
+	_, hasResult := fields["result"]
+	_, hasError := fields["error"]
+
+	if !hasResult && !hasError {
+		return string(data), nil
+	}
+
+	var response externalToolResponse
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return "", fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if response.Error != "" {
+		return "", fmt.Errorf("%s", response.Error)
+	}
+
+	return response.Result, nil
+}
+
+func externalToolTimeout(tool config.ExternalTool) time.Duration {
+	if tool.Timeout > 0 {
+		return tool.Timeout
+	}
+
+	return defaultExternalToolTimeout
+}
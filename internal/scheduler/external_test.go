@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+func writeScript(t *testing.T, path string, result string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "#!/bin/sh\ncat > /dev/null\necho '{\"result\": \"" + result + "\"}'\n"
+
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandToolRunsConfiguredScript(t *testing.T) {
+	configDir := t.TempDir()
+	workspace := t.TempDir()
+
+	writeScript(t, filepath.Join(configDir, "scripts", "lint.sh"), "configured")
+	// An agent may write a script at the same path in the workspace
+	writeScript(t, filepath.Join(workspace, "scripts", "lint.sh"), "workspace")
+
+	caller := NewTaskScheduler(t.Context(), nil, workspace).ToolCaller
+
+	if err := caller.RegisterExternal([]config.ExternalTool{{Name: "lint", Command: []string{"./scripts/lint.sh"}}}, configDir); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := caller.Tools["lint"].Call(context.Background(), map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != "configured" {
+		t.Fatalf("expected the script next to the config to run, got %q", result)
+	}
+}
+
+func TestRegisterExternalRejectsUnknownCommands(t *testing.T) {
+	caller := NewTaskScheduler(t.Context(), nil, t.TempDir()).ToolCaller
+
+	err := caller.RegisterExternal([]config.ExternalTool{{Name: "lint", Command: []string{"surely-not-an-installed-linter"}}}, t.TempDir())
+	if err == nil {
+		t.Fatal("expected a command missing from PATH to be rejected")
+	}
+}
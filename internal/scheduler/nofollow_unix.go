@@ -0,0 +1,8 @@
+//go:build unix
+
+package scheduler
+
+import "syscall"
+
+// openNoFollow makes opening a symbolic link fail instead of following it.
+const openNoFollow = syscall.O_NOFOLLOW
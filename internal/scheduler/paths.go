@@ -0,0 +1,180 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathError is returned when a tool is given a path outside the workspace.
+// Its message is meant to be read by the model so it can correct the call.
+type PathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("invalid path %q: %s, use a path relative to the project root such as \"src/main.go\"", e.Path, e.Reason)
+}
+
+// resolvePath maps a model supplied path to an absolute path inside root.
+// Symlinks are resolved, so a link pointing outside the workspace is
+// rejected as well. The path doesn't need to exist.
+func resolvePath(root string, path string) (string, error) {
+	root, err := canonicalPath(root)
+	if err != nil {
+		return "", fmt.Errorf("error resolving workspace root: %w", err)
+	}
+
+	candidate := path
+	if !filepath.IsAbs(candidate) {
+		candidate = filepath.Join(root, candidate)
+	}
+
+	resolved, err := canonicalPath(candidate)
+	if err != nil {
+		return "", &PathError{Path: path, Reason: err.Error()}
+	}
+
+	if !isWithin(root, resolved) {
+		return "", &PathError{Path: path, Reason: "it is outside the project root"}
+	}
+
+	if isReserved(root, resolved) {
+		return "", &PathError{Path: path, Reason: "it is reserved for the state of the run"}
+	}
+
+	return resolved, nil
+}
+
+// isReserved reports whether path is the state file in root or one of the
+// temporary files it is written through, which the agents must neither read
+// nor change.
+func isReserved(root string, path string) bool {
+	if filepath.Dir(path) != root {
+		return false
+	}
+
+	// Case insensitive, as the file system may be
+	name := strings.ToLower(filepath.Base(path))
+	reserved := strings.ToLower(StateFileName)
+
+	return name == reserved || strings.HasPrefix(name, reserved+".")
+}
+
+// maxSymlinkHops bounds the dangling symlinks followed by canonicalPath.
+const maxSymlinkHops = 40
+
+// canonicalPath returns the absolute, symlink free form of path. Components
+// that don't exist yet are appended to the resolved existing prefix. A
+// dangling symlink is replaced by its target, which is where a write through
+// it would land.
+func canonicalPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	missing := []string{}
+	existing := path
+	hops := 0
+
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		if info, err := os.Lstat(existing); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			hops++
+			if hops > maxSymlinkHops {
+				return "", errors.New("too many levels of symbolic links")
+			}
+
+			target, err := os.Readlink(existing)
+			if err != nil {
+				return "", err
+			}
+
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(existing), target)
+			}
+
+			existing = target
+
+			continue
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path, nil
+		}
+
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = parent
+	}
+}
+
+// writeWorkspaceFile writes data to path, as returned by resolvePath for
+// root. The path is resolved again once its parents exist and the file is
+// opened without following symlinks, so a link created in the meantime can't
+// redirect the write outside the workspace.
+func writeWorkspaceFile(root string, path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating parent directories: %w", err)
+	}
+
+	resolved, err := resolvePath(root, path)
+	if err != nil {
+		return err
+	}
+
+	if resolved != path {
+		return &PathError{Path: path, Reason: "it was changed to a symbolic link while being written"}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|openNoFollow, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close() //nolint:errcheck
+
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	return nil
+}
+
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+func (t *ToolCaller) resolvePath(path string) (string, error) {
+	return resolvePath(t.TaskScheduler.OutputFolder, path)
+}
+
+func (t *ToolCaller) writeFileAt(path string, data []byte) error {
+	return writeWorkspaceFile(t.TaskScheduler.OutputFolder, path, data)
+}
+
+func (t *ToolCaller) workspaceRoot() (string, error) {
+	return canonicalPath(t.TaskScheduler.OutputFolder)
+}
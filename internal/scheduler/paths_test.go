@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(root, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"outside":       filepath.Join(outside, "secret.txt"),
+		"outside-dir":   outside,
+		"dangling":      filepath.Join(outside, "missing.txt"),
+		"dangling-dir":  filepath.Join(outside, "missing"),
+		"dangling-rel":  "../" + filepath.Base(outside) + "/missing.txt",
+		"inside":        "src",
+		"inside-future": "src/new.txt",
+	}
+
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{path: "src/main.go", allowed: true},
+		{path: "new/dir/file.txt", allowed: true},
+		{path: "inside/main.go", allowed: true},
+		{path: "inside-future", allowed: true},
+		{path: "../escape.txt"},
+		{path: filepath.Join(outside, "secret.txt")},
+		{path: "outside"},
+		{path: "outside-dir/secret.txt"},
+		{path: "dangling"},
+		{path: "dangling-dir/file.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			resolved, err := resolvePath(root, test.path)
+
+			if test.allowed {
+				if err != nil {
+					t.Fatalf("expected %q to be allowed, got %v", test.path, err)
+				}
+
+				canonicalRoot, _ := filepath.EvalSymlinks(root)
+				if !isWithin(canonicalRoot, resolved) {
+					t.Fatalf("expected %q to resolve inside the root, got %q", test.path, resolved)
+				}
+
+				return
+			}
+
+			var pathErr *PathError
+			if !errors.As(err, &pathErr) {
+				t.Fatalf("expected %q to be rejected, got %q, %v", test.path, resolved, err)
+			}
+		})
+	}
+}
+
+func TestWriteWorkspaceFileDoesNotFollowLinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	target := filepath.Join(outside, "outside.txt")
+
+	if err := os.Symlink(target, filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resolvePath(root, "out"); err == nil {
+		t.Fatal("expected the dangling link to be rejected")
+	}
+
+	// A link swapped in after the path was resolved
+	canonicalRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(canonicalRoot, "later.txt")
+
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeWorkspaceFile(canonicalRoot, path, []byte("data")); err == nil {
+		t.Fatal("expected the write through the link to fail")
+	}
+
+	if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected nothing to be written outside the workspace, got %v", err)
+	}
+
+	if err := writeWorkspaceFile(canonicalRoot, filepath.Join(canonicalRoot, "a", "b.txt"), []byte("data")); err != nil {
+		t.Fatalf("expected the write inside the workspace to succeed, got %v", err)
+	}
+}
+
+func TestToolsCannotAccessState(t *testing.T) {
+	root := t.TempDir()
+	scheduler := NewTaskScheduler(t.Context(), nil, root)
+	scheduler.SaveState()
+
+	if err := os.Symlink(StateFileName, filepath.Join(root, "state-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := os.ReadFile(scheduler.Store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caller := scheduler.ToolCaller
+
+	for _, file := range []string{StateFileName, "./src/../" + StateFileName, StateFileName + ".123", "state-link"} {
+		calls := map[string]func() (string, error){
+			"read-file": func() (string, error) {
+				return caller.readFile(t.Context(), map[string]any{"file": file})
+			},
+			"write-file": func() (string, error) {
+				return caller.writeFile(t.Context(), map[string]any{"file": file, "content": "garbage"})
+			},
+			"edit-file": func() (string, error) {
+				return caller.editFile(t.Context(), map[string]any{"file": file, "search": "tasks", "replace": "garbage"})
+			},
+		}
+
+		for tool, call := range calls {
+			t.Run(tool+" "+file, func(t *testing.T) {
+				var pathErr *PathError
+				if _, err := call(); !errors.As(err, &pathErr) {
+					t.Fatalf("expected the state file to be rejected, got %v", err)
+				}
+			})
+		}
+	}
+
+	data, err := os.ReadFile(scheduler.Store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(original) {
+		t.Fatal("expected the state file to be left unchanged")
+	}
+}
@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// Tool is the implementation behind a function the agents can call.
+type Tool interface {
+	Call(ctx context.Context, args map[string]any) (string, error)
+}
+
+// DescribedTool is implemented by tools that know the arguments they
+// accept, so the schema declared in the config can be checked at startup.
+type DescribedTool interface {
+	Tool
+	Parameters() config.Parameter
+}
+
+// ToolFunc adapts a function to the Tool interface.
+type ToolFunc func(ctx context.Context, args map[string]any) (string, error)
+
+func (f ToolFunc) Call(ctx context.Context, args map[string]any) (string, error) {
+	return f(ctx, args)
+}
+
+type describedToolFunc struct {
+	ToolFunc
+	parameters config.Parameter
+}
+
+func (f describedToolFunc) Parameters() config.Parameter {
+	return f.parameters
+}
+
+// Register adds a tool under the given name, failing if the name is taken.
+func (t *ToolCaller) Register(name string, tool Tool) error {
+	if _, ok := t.Tools[name]; ok {
+		return fmt.Errorf("tool %s is already registered", name)
+	}
+
+	t.Tools[name] = tool
+
+	return nil
+}
+
+// RegisterExternal registers the tools implemented outside of the program,
+// as executables or HTTP endpoints. Relative executables are resolved
+// against configDir, the directory of the config file.
+func (t *ToolCaller) RegisterExternal(tools []config.ExternalTool, configDir string) error {
+	for _, tool := range tools {
+		var implementation Tool
+
+		switch {
+		case len(tool.Command) > 0 && tool.URL != "":
+			return fmt.Errorf("tool %s: command and url are mutually exclusive", tool.Name)
+		case len(tool.Command) > 0:
+			commandTool, err := NewCommandTool(t, tool, configDir)
+			if err != nil {
+				return err
+			}
+
+			implementation = commandTool
+		case tool.URL != "":
+			implementation = NewHTTPTool(tool)
+		default:
+			return fmt.Errorf("tool %s: command or url is required", tool.Name)
+		}
+
+		if err := t.Register(tool.Name, implementation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateAgents checks that every tool the agents declare is registered
+// and that its declared schema agrees with the implementation.
+func (t *ToolCaller) ValidateAgents(agents []config.Agent) error {
+	for _, a := range agents {
+		for _, tool := range a.Tools {
+			if tool.Function == nil {
+				continue
+			}
+
+			implementation, ok := t.Tools[tool.Function.Name]
+			if !ok {
+				return fmt.Errorf("agent %s declares tool %s, which is not registered", a.Name, tool.Function.Name)
+			}
+
+			described, ok := implementation.(DescribedTool)
+			if !ok {
+				continue
+			}
+
+			if err := validateSchema(tool.Function.Parameters, described.Parameters()); err != nil {
+				return fmt.Errorf("agent %s declares tool %s with a wrong schema: %w", a.Name, tool.Function.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateSchema checks that the declared parameters are all known to the
+// implementation with the same type, and that the parameters the
+// implementation requires are all declared.
+func validateSchema(declared config.Parameter, expected config.Parameter) error {
+	for name, property := range declared.Properties {
+		expectedProperty, ok := expected.Properties[name]
+		if !ok {
+			return fmt.Errorf("unknown parameter %s", name)
+		}
+
+		if property.Type != "" && !compatibleTypes(property.Type, expectedProperty.Type) {
+			return fmt.Errorf("parameter %s has type %s, expected %s", name, property.Type, expectedProperty.Type)
+		}
+	}
+
+	for _, name := range declared.Required {
+		if _, ok := declared.Properties[name]; !ok {
+			return fmt.Errorf("required parameter %s is not declared in the properties", name)
+		}
+	}
+
+	for _, name := range expected.Required {
+		if !slices.Contains(declared.Required, name) {
+			return fmt.Errorf("parameter %s must be declared as required", name)
+		}
+	}
+
+	return nil
+}
+
+func compatibleTypes(declared string, expected string) bool {
+	// Every integer is a valid number
+	return declared == expected || (declared == "integer" && expected == "number")
+}
+
+// parameters builds the schema of a built-in tool from its properties and
+// their types.
+func parameters(required []string, properties map[string]string) config.Parameter {
+	p := config.Parameter{
+		Type:       "object",
+		Required:   required,
+		Properties: make(map[string]config.ParameterProperties, len(properties)),
+	}
+
+	for name, propertyType := range properties {
+		p.Properties[name] = config.ParameterProperties{Type: propertyType}
+	}
+
+	return p
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type TaskReport struct {
+	Summary    string    `json:"summary"`
+	Artifacts  []string  `json:"artifacts,omitempty"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+type taskIDKey struct{}
+
+// withTaskID marks ctx as belonging to the execution of the given task, so
+// tools like complete-task know which task they refer to.
+func withTaskID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, taskIDKey{}, id)
+}
+
+func taskIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(taskIDKey{}).(string)
+
+	return id, ok
+}
+
+// ReportTask attaches the worker report to the task.
+func (t *TaskScheduler) ReportTask(id string, report *TaskReport) error {
+	t.mu.Lock()
+
+	task := t.findTask(id)
+	if task == nil {
+		t.mu.Unlock()
+
+		return fmt.Errorf("task %s not found", id)
+	}
+
+	report.ReportedAt = time.Now()
+	task.Report = report
+
+	t.mu.Unlock()
+
+	slog.Info("Task reported", "task", task.Description, "summary", report.Summary)
+
+	t.SaveState()
+
+	return nil
+}
+
+// queueReport schedules a finished task to be reported to the manager. It
+// must be called with t.mu held.
+func (t *TaskScheduler) queueReport(task *Task) {
+	if !t.ReportToManager || task.AssignedTo == t.Manager {
+		return
+	}
+
+	t.pendingReports = append(t.pendingReports, task.ID)
+}
+
+// dispatchReports hands the queued reports to the manager if it is idle. It
+// must be called with t.mu held.
+func (t *TaskScheduler) dispatchReports() {
+	if len(t.pendingReports) == 0 {
+		return
+	}
+
+	if t.MaxConcurrency > 0 && t.inFlight >= t.MaxConcurrency {
+		return
+	}
+
+	workers, ok := t.workers[t.Manager]
+	if !ok || workers[0].busy {
+		return
+	}
+
+	w := workers[0]
+
+	tasks := make([]Task, 0, len(t.pendingReports))
+	for _, id := range t.pendingReports {
+		if task := t.findTask(id); task != nil {
+			tasks = append(tasks, *task)
+		}
+	}
+
+	t.pendingReports = nil
+
+	w.busy = true
+	t.inFlight++
+	t.running.Add(1)
+
+	go t.consultManager(w, tasks)
+}
+
+// consultManager routes the reports of finished tasks into the manager
+// conversation, letting it review them and assign follow-up tasks.
+func (t *TaskScheduler) consultManager(w *worker, tasks []Task) {
+	defer t.running.Done()
+
+	defer func() {
+		t.mu.Lock()
+		w.busy = false
+		t.inFlight--
+		t.mu.Unlock()
+
+		t.notify()
+	}()
+
+	var message strings.Builder
+	message.WriteString("The following tasks have finished:\n")
+
+	for _, task := range tasks {
+		fmt.Fprintf(&message, "\n- Task %s assigned to %s: %s\n  Status: %s\n", task.ID, task.AssignedTo, task.Description, task.Status)
+
+		if task.Error != "" {
+			fmt.Fprintf(&message, "  Error: %s\n", task.Error)
+		}
+
+		if task.Report != nil {
+			fmt.Fprintf(&message, "  Summary: %s\n", task.Report.Summary)
+
+			if len(task.Report.Artifacts) > 0 {
+				fmt.Fprintf(&message, "  Artifacts: %s\n", strings.Join(task.Report.Artifacts, ", "))
+			}
+		}
+	}
+
+	message.WriteString("\nReview the results. If something is missing or wrong, assign follow-up tasks with the \"assign-task\" tool.")
+
+	slog.Info("Reporting tasks to the manager", "manager", t.Manager, "tasks", len(tasks))
+
+	resp, err := w.agent.ChatWithTools(t.ctx, message.String(), t.ToolExecutor(t.Manager))
+	if err != nil {
+		slog.Error("Error reporting tasks to the manager", "manager", t.Manager, "error", err)
+
+		return
+	}
+
+	if resp.Message != "" {
+		slog.Debug("The response from the manager is: ", "response", resp.Message)
+	}
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/agent"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	ErrorClassTransient = "transient"
+	ErrorClassStepLimit = "step_limit"
+	ErrorClassOther     = "other"
+)
+
+var defaultRetryPolicy = config.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     time.Minute,
+	Retryable:      []string{ErrorClassTransient},
+}
+
+// retryPolicy returns the policy for the given agent, falling back to the
+// scheduler-wide policy and then to the defaults for unset fields.
+func (t *TaskScheduler) retryPolicy(agentName string) config.RetryPolicy {
+	policy := defaultRetryPolicy
+
+	overrides := []*config.RetryPolicy{t.RetryPolicy}
+	if a, ok := t.Agents[agentName]; ok {
+		overrides = append(overrides, a.Config.Retry)
+	}
+
+	for _, override := range overrides {
+		if override == nil {
+			continue
+		}
+
+		if override.MaxAttempts > 0 {
+			policy.MaxAttempts = override.MaxAttempts
+		}
+
+		if override.InitialBackoff > 0 {
+			policy.InitialBackoff = override.InitialBackoff
+		}
+
+		if override.MaxBackoff > 0 {
+			policy.MaxBackoff = override.MaxBackoff
+		}
+
+		if override.Retryable != nil {
+			policy.Retryable = override.Retryable
+		}
+	}
+
+	return policy
+}
+
+// shouldRetry reports whether a task that failed with err after the given
+// number of attempts should be scheduled again.
+func shouldRetry(policy config.RetryPolicy, attempts int, err error) bool {
+	return attempts < policy.MaxAttempts && slices.Contains(policy.Retryable, classifyError(err))
+}
+
+// backoff returns the delay before the next attempt, doubling after every
+// failed attempt up to the policy maximum.
+func backoff(policy config.RetryPolicy, attempts int) time.Duration {
+	delay := policy.InitialBackoff
+
+	for i := 1; i < attempts && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, policy.MaxBackoff)
+}
+
+func classifyError(err error) string {
+	if errors.Is(err, agent.ErrMaxToolSteps) {
+		return ErrorClassStepLimit
+	}
+
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError {
+			return ErrorClassTransient
+		}
+
+		return ErrorClassOther
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTransient
+	}
+
+	return ErrorClassOther
+}
@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxSearchMatches     = 200
+	maxSearchFileSize    = 1024 * 1024
+	maxSearchContext     = 5
+	maxSearchSnippetSize = 300
+)
+
+// searchFiles greps the workspace. Matches are reported as file:line:text,
+// context lines as file-line-text, like grep does.
+func (t *ToolCaller) searchFiles(ctx context.Context, args map[string]any) (string, error) {
+	query, _ := args["query"].(string)
+	if query == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	if isRegex, _ := args["regex"].(bool); !isRegex {
+		query = regexp.QuoteMeta(query)
+	}
+
+	if caseSensitive, ok := args["case_sensitive"].(bool); ok && !caseSensitive {
+		query = "(?i)" + query
+	}
+
+	matcher, err := regexp.Compile(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	contextLines := 0
+	if n, ok := args["context_lines"].(float64); ok && n > 0 {
+		contextLines = min(int(n), maxSearchContext)
+	}
+
+	include, includeSlash, err := optionalGlob(args, "include")
+	if err != nil {
+		return "", err
+	}
+
+	exclude, excludeSlash, err := optionalGlob(args, "exclude")
+	if err != nil {
+		return "", err
+	}
+
+	root, err := t.workspaceRoot()
+	if err != nil {
+		return "", fmt.Errorf("error resolving workspace root: %w", err)
+	}
+
+	start := root
+
+	if args["working_directory"] != nil {
+		start, err = t.resolvePath(args["working_directory"].(string))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	results := []string{}
+	matches := 0
+	truncated := false
+
+	err = walkWorkspace(root, start, 0, func(e walkEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Symlinks may point outside the workspace, they are not followed
+		if !e.entry.Type().IsRegular() {
+			return nil
+		}
+
+		if include != nil && !matchGlob(include, includeSlash, e.rel) {
+			return nil
+		}
+
+		if exclude != nil && matchGlob(exclude, excludeSlash, e.rel) {
+			return nil
+		}
+
+		info, err := e.entry.Info()
+		if err != nil || info.Size() > maxSearchFileSize {
+			return nil
+		}
+
+		content, err := readNoFollow(filepath.Join(root, filepath.FromSlash(e.rel)))
+		if err != nil || isBinary(content) {
+			return nil
+		}
+
+		lines, _ := splitLines(string(content))
+		lastPrinted := -1
+
+		for i, line := range lines {
+			if !matcher.MatchString(line) {
+				continue
+			}
+
+			if matches >= maxSearchMatches {
+				truncated = true
+
+				return filepath.SkipAll
+			}
+
+			matches++
+
+			from := max(i-contextLines, lastPrinted+1)
+			to := min(i+contextLines, len(lines)-1)
+
+			if lastPrinted >= 0 && from > lastPrinted+1 {
+				results = append(results, "--")
+			}
+
+			for j := from; j <= to; j++ {
+				separator := "-"
+				if matcher.MatchString(lines[j]) {
+					separator = ":"
+				}
+
+				results = append(results, fmt.Sprintf("%s%s%d%s%s", e.rel, separator, j+1, separator, snippet(lines[j])))
+			}
+
+			lastPrinted = to
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error searching files: %w", err)
+	}
+
+	if matches == 0 {
+		return "no matches found", nil
+	}
+
+	if truncated {
+		results = append(results, fmt.Sprintf("... stopped after %d matches, narrow the search with working_directory, include or a more specific query", maxSearchMatches))
+	}
+
+	return strings.Join(results, "\n"), nil
+}
+
+func optionalGlob(args map[string]any, name string) (*regexp.Regexp, bool, error) {
+	glob, _ := args[name].(string)
+	if glob == "" {
+		return nil, false, nil
+	}
+
+	pattern, err := globToRegexp(glob)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid %s pattern %q: %w", name, glob, err)
+	}
+
+	return pattern, strings.Contains(glob, "/"), nil
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000
+// bytes.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+func snippet(line string) string {
+	if len(line) <= maxSearchSnippetSize {
+		return line
+	}
+
+	return line[:maxSearchSnippetSize] + "..."
+}
+
+// readNoFollow reads the file at path, failing if it was replaced by a
+// symlink since the workspace was walked.
+func readNoFollow(path string) ([]byte, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|openNoFollow, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint:errcheck
+
+	return io.ReadAll(file)
+}
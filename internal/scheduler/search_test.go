@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchFilesSkipsSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(outside, "passwd"), []byte("root:x:0:0:needle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main // needle\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(filepath.Join(outside, "passwd"), filepath.Join(root, "passwd")); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewTaskScheduler(context.Background(), nil, root)
+
+	result, err := scheduler.ToolCaller.searchFiles(context.Background(), map[string]any{"query": "needle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "main.go:1:") {
+		t.Fatalf("expected the workspace file to match, got %q", result)
+	}
+
+	if strings.Contains(result, "root:x") {
+		t.Fatalf("expected the linked file not to be searched, got %q", result)
+	}
+}
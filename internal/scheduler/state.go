@@ -0,0 +1,114 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+const StateFileName = ".agents-state.json"
+
+type ToolCallRecord struct {
+	Agent     string         `json:"agent"`
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments"`
+	Result    string         `json:"result,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	CalledAt  time.Time      `json:"called_at"`
+}
+
+type State struct {
+	Tasks          []*Task                  `json:"tasks"`
+	Histories      map[string][]api.Message `json:"histories"`
+	ToolCalls      []ToolCallRecord         `json:"tool_calls"`
+	Reviews        int                      `json:"reviews"`
+	GoalComplete   bool                     `json:"goal_complete"`
+	PendingReports []string                 `json:"pending_reports,omitempty"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+}
+
+// StateStore persists the scheduler state as a JSON file so a run can be
+// resumed after a crash or an interrupt.
+type StateStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewStateStore(outputFolder string) *StateStore {
+	return &StateStore{
+		path: filepath.Join(outputFolder, StateFileName),
+	}
+}
+
+func (s *StateStore) Path() string {
+	return s.path
+}
+
+// Load reads the saved state. The error wraps os.ErrNotExist when no state
+// was saved yet.
+func (s *StateStore) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := &State{
+		Tasks:     []*Task{},
+		Histories: map[string][]api.Message{},
+		ToolCalls: []ToolCallRecord{},
+	}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no state saved yet: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error decoding state file: %w", err)
+	}
+
+	return state, nil
+}
+
+// Save writes the state atomically, so a crash mid-write never leaves a
+// truncated file behind.
+func (s *StateStore) Save(state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), StateFileName+".*")
+	if err != nil {
+		return fmt.Errorf("error creating state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error replacing state file: %w", err)
+	}
+
+	return nil
+}
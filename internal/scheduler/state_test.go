@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadWithoutState(t *testing.T) {
+	if _, err := NewStateStore(t.TempDir()).Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing state to be reported, got %v", err)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	folder := t.TempDir()
+
+	saved := NewTaskScheduler(t.Context(), nil, folder)
+
+	if err := saved.AddTask(&Task{Description: "build the server"}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved.Tasks[0].Status = TaskStatusInProgress
+	saved.reviews = 2
+	saved.goalComplete = true
+	saved.pendingReports = []string{saved.Tasks[0].ID}
+
+	saved.SaveState()
+
+	state, err := saved.Store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewTaskScheduler(t.Context(), nil, folder)
+	restored.Restore(state)
+
+	if len(restored.Tasks) != 1 || restored.Tasks[0].Status != TaskStatusInterrupted {
+		t.Fatalf("expected the task in progress to be restored as interrupted, got %+v", restored.Tasks)
+	}
+
+	if restored.reviews != 2 || !restored.goalComplete {
+		t.Fatalf("expected the review progress to be restored, got %d reviews and goal complete %v", restored.reviews, restored.goalComplete)
+	}
+
+	if !slices.Equal(restored.pendingReports, saved.pendingReports) {
+		t.Fatalf("expected the pending reports %v, got %v", saved.pendingReports, restored.pendingReports)
+	}
+}
+
+func TestToolCallsAreStoredShortened(t *testing.T) {
+	scheduler := NewTaskScheduler(t.Context(), nil, t.TempDir())
+	content := strings.Repeat("a", 10*maxAuditValueSize)
+
+	// Denied, no agent is allowed tools here, but recorded all the same
+	scheduler.ToolExecutor("backend-developer")(t.Context(), "write-file", map[string]any{"file": "main.go", "content": content}) //nolint:errcheck
+
+	state, err := scheduler.Store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(state.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got %d", len(state.ToolCalls))
+	}
+
+	stored, _ := state.ToolCalls[0].Arguments["content"].(string)
+	if len(stored) > 2*maxAuditValueSize || !strings.Contains(stored, "bytes)") {
+		t.Fatalf("expected the content to be shortened, got %d bytes", len(stored))
+	}
+
+	if state.ToolCalls[0].Arguments["file"] != "main.go" {
+		t.Fatalf("expected the short arguments to be kept, got %v", state.ToolCalls[0].Arguments)
+	}
+}
@@ -2,12 +2,19 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Al-Pragliola/poc-dev-agents/internal/agent"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
 	"github.com/google/uuid"
+	"github.com/ollama/ollama/api"
 )
 
 type TaskStatus string
@@ -17,31 +24,76 @@ const (
 	TaskStatusInProgress TaskStatus = "in_progress"
 	TaskStatusCompleted  TaskStatus = "completed"
 	TaskStatusFailed     TaskStatus = "failed"
+	// TaskStatusInterrupted marks a task that was stopped mid-execution by a
+	// shutdown; it is picked up again like a pending task.
+	TaskStatusInterrupted TaskStatus = "interrupted"
 )
 
 type Task struct {
-	ID          string     `json:"id"`
-	Description string     `json:"description"`
-	AssignedTo  string     `json:"assigned_to"`
-	Status      TaskStatus `json:"status"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID            string      `json:"id"`
+	Description   string      `json:"description"`
+	AssignedTo    string      `json:"assigned_to"`
+	DependsOn     []string    `json:"depends_on,omitempty"`
+	Status        TaskStatus  `json:"status"`
+	Attempts      int         `json:"attempts,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	NextAttemptAt time.Time   `json:"next_attempt_at,omitzero"`
+	Report        *TaskReport `json:"report,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
 }
 
 type TaskScheduler struct {
-	ctx          context.Context
-	Tasks        []*Task
-	Agents       map[string]*agent.Agent
-	ToolCaller   *ToolCaller
-	OutputFolder string
+	ctx             context.Context
+	cancel          context.CancelFunc
+	running         sync.WaitGroup
+	mu              sync.Mutex
+	saveMu          sync.Mutex
+	wake            chan struct{}
+	workers         map[string][]*worker
+	inFlight        int
+	Tasks           []*Task
+	Agents          map[string]*agent.Agent
+	ToolCaller      *ToolCaller
+	OutputFolder    string
+	Store           *StateStore
+	MaxConcurrency  int
+	RetryPolicy     *config.RetryPolicy
+	Manager         string
+	MaxReviews      int
+	reviews         int
+	goalComplete    bool
+	ReportToManager bool
+	pendingReports  []string
+	toolCalls       []ToolCallRecord
 }
 
-func NewTaskScheduler(agents map[string]*agent.Agent, outputFolder string) *TaskScheduler {
+// worker is one execution slot of an agent. The first worker of every agent
+// uses the agent itself, additional ones use forks with their own history.
+type worker struct {
+	name  string
+	agent *agent.Agent
+	busy  bool
+}
+
+func NewTaskScheduler(ctx context.Context, agents map[string]*agent.Agent, outputFolder string) *TaskScheduler {
+	ctx, cancel := context.WithCancel(ctx)
+
 	t := &TaskScheduler{
-		ctx:          context.Background(),
+		ctx:          ctx,
+		cancel:       cancel,
+		wake:         make(chan struct{}, 1),
+		workers:      make(map[string][]*worker, len(agents)),
 		Tasks:        []*Task{},
-		Agents:       agents,
+		Agents:       make(map[string]*agent.Agent, len(agents)),
 		OutputFolder: outputFolder,
+		Store:        NewStateStore(outputFolder),
+		Manager:      config.DefaultManager,
+		toolCalls:    []ToolCallRecord{},
+	}
+
+	for name, a := range agents {
+		t.AddAgent(name, a)
 	}
 
 	t.ToolCaller = NewToolCaller(t)
@@ -49,81 +101,162 @@ func NewTaskScheduler(agents map[string]*agent.Agent, outputFolder string) *Task
 	return t
 }
 
-func (t *TaskScheduler) Run() {
+// AddAgent makes an agent that is set up available to the tasks, with one
+// worker per unit of its concurrency.
+func (t *TaskScheduler) AddAgent(name string, a *agent.Agent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	concurrency := max(a.Config.Concurrency, 1)
+
+	t.Agents[name] = a
+	t.workers[name] = []*worker{{name: name, agent: a}}
+
+	for i := 1; i < concurrency; i++ {
+		t.workers[name] = append(t.workers[name], &worker{
+			name:  fmt.Sprintf("%s#%d", name, i+1),
+			agent: a.Fork(),
+		})
+	}
+}
+
+// Run dispatches tasks until the context is cancelled or the run completes:
+// nothing is left to schedule and the manager, if reviews are enabled, has
+// no further tasks to assign. It returns nil if the run succeeded.
+func (t *TaskScheduler) Run() error {
+	return <-t.Start()
+}
+
+// Start runs the scheduler in the background and returns the channel
+// receiving the result of Run. The run is tracked before Start returns, so
+// a Stop called right after still waits for it.
+func (t *TaskScheduler) Start() <-chan error {
+	done := make(chan error, 1)
+
+	t.running.Add(1)
+
+	go func() {
+		defer t.running.Done()
+
+		done <- t.run()
+	}()
+
+	return done
+}
+
+func (t *TaskScheduler) run() error {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for {
-		select {
-		case <-t.ctx.Done():
-			slog.Info("Stopping task scheduler...")
-			return
-		case <-ticker.C:
+		if t.dispatch() {
+			t.SaveState()
+		}
 
-			if t.checkForInProgressTasks() {
-				slog.Debug("There are still tasks in progress, skipping...")
+		t.mu.Lock()
+		quiescent := t.isQuiescent()
+		t.mu.Unlock()
 
-				continue
-			}
+		if quiescent {
+			if t.reviews >= t.MaxReviews {
+				slog.Info("All tasks are done, stopping task scheduler...")
 
-			// Get the next pending task
-			task := t.getNextPendingTask()
+				return t.outcome()
+			}
 
-			if task == nil {
-				slog.Debug("No pending tasks, skipping...")
+			created, err := t.review()
+			if err != nil {
+				if t.ctx.Err() != nil {
+					return t.ctx.Err()
+				}
 
-				continue
+				return err
 			}
 
-			slog.Info("Scheduling task", "task", task.Description, "to", task.AssignedTo)
+			if !created {
+				slog.Info("The manager has no more tasks to assign, stopping task scheduler...")
 
-			// Update task status to in progress
-			if err := t.updateTaskStatus(task, TaskStatusInProgress); err != nil {
-				slog.Error("Failed to update task status", "task", task.Description, "error", err)
-
-				continue
+				return t.outcome()
 			}
 
-			// Execute the task
-			if err := t.executeTask(task.AssignedTo, task); err != nil {
-				slog.Error("Task execution failed", "task", task.Description, "error", err)
-
-				if err := t.updateTaskStatus(task, TaskStatusFailed); err != nil {
-					slog.Error("Failed to update task status to failed", "task", task.Description, "error", err)
-				}
+			continue
+		}
 
-				return
-			}
+		select {
+		case <-t.ctx.Done():
+			slog.Info("Stopping task scheduler...")
+			return t.ctx.Err()
+		case <-ticker.C:
+		case <-t.wake:
 		}
 	}
 }
 
-func (t *TaskScheduler) AddTask(task *Task) {
+// checkAssignee reports an error listing the agents when name isn't one of
+// them, so the manager can assign the task again.
+func (t *TaskScheduler) checkAssignee(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.Agents[name]; ok {
+		return nil
+	}
+
+	return fmt.Errorf("unknown assignee %q, expected one of: %s", name, strings.Join(slices.Sorted(maps.Keys(t.Agents)), ", "))
+}
+
+func (t *TaskScheduler) AddTask(task *Task) error {
 	task.ID = uuid.New().String()
 	task.CreatedAt = time.Now()
 	task.UpdatedAt = time.Now()
 	task.Status = TaskStatusPending
 
-	slog.Info("Adding task", "task", task.Description, "assigned to", task.AssignedTo)
+	t.mu.Lock()
 
-	t.Tasks = append(t.Tasks, task)
-}
+	for _, id := range task.DependsOn {
+		if t.findTask(id) == nil {
+			t.mu.Unlock()
 
-func (t *TaskScheduler) GetTask(id string) *Task {
-	for _, task := range t.Tasks {
-		if task.ID == id {
-			return task
+			return fmt.Errorf("dependency %s not found", id)
 		}
 	}
 
+	if cycle := findCycle(append(t.Tasks[:len(t.Tasks):len(t.Tasks)], task)); cycle != nil {
+		t.mu.Unlock()
+
+		return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+	}
+
+	slog.Info("Adding task", "task", task.Description, "assigned to", task.AssignedTo, "depends on", task.DependsOn)
+
+	t.Tasks = append(t.Tasks, task)
+	t.goalComplete = false
+	t.mu.Unlock()
+
+	t.SaveState()
+	t.notify()
+
 	return nil
 }
 
+func (t *TaskScheduler) GetTask(id string) *Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.findTask(id)
+}
+
 func (t *TaskScheduler) GetTasks() []*Task {
-	return t.Tasks
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*Task(nil), t.Tasks...)
 }
 
 func (t *TaskScheduler) GetTasksByAssignedTo(assignedTo string) []*Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	var tasks []*Task
 
 	for _, task := range t.Tasks {
@@ -135,73 +268,347 @@ func (t *TaskScheduler) GetTasksByAssignedTo(assignedTo string) []*Task {
 	return tasks
 }
 
-func (t *TaskScheduler) Stop() {
-	t.ctx.Done()
+// Stop cancels the scheduler context and waits for the in-flight tasks to
+// drain, giving up when ctx expires.
+func (t *TaskScheduler) Stop(ctx context.Context) error {
+	t.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		t.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timeout waiting for running tasks to stop: %w", ctx.Err())
+	}
+}
+
+// dispatch starts every runnable task whose dependencies completed and that
+// has an idle worker for its assignee, as long as the global concurrency cap
+// allows it. It reports whether any task changed status.
+func (t *TaskScheduler) dispatch() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ctx.Err() != nil {
+		return false
+	}
+
+	changed := t.propagateFailures()
+
+	t.dispatchReports()
+
+	for _, task := range t.Tasks {
+		if !isRunnable(task) {
+			continue
+		}
+
+		if ready, _ := t.dependencyState(task); !ready {
+			continue
+		}
+
+		if time.Now().Before(task.NextAttemptAt) {
+			continue
+		}
+
+		if t.MaxConcurrency > 0 && t.inFlight >= t.MaxConcurrency {
+			slog.Debug("Concurrency limit reached, skipping...", "limit", t.MaxConcurrency)
+
+			return changed
+		}
+
+		workers, ok := t.workers[task.AssignedTo]
+		if !ok {
+			slog.Error("Task execution failed", "task", task.Description, "error", "agent not found")
+
+			task.Error = fmt.Sprintf("agent %s not found", task.AssignedTo)
+			t.setTaskStatus(task, TaskStatusFailed)
+			changed = true
+
+			continue
+		}
+
+		w := idleWorker(workers)
+		if w == nil {
+			continue
+		}
+
+		slog.Info("Scheduling task", "task", task.Description, "to", w.name)
+
+		t.setTaskStatus(task, TaskStatusInProgress)
+		changed = true
+
+		w.busy = true
+		t.inFlight++
+		t.running.Add(1)
+
+		go t.work(w, task)
+	}
+
+	return changed
+}
+
+func (t *TaskScheduler) work(w *worker, task *Task) {
+	defer t.running.Done()
+
+	defer func() {
+		t.mu.Lock()
+		w.busy = false
+		t.inFlight--
+		t.mu.Unlock()
+
+		t.notify()
+	}()
+
+	message, err := t.executeTask(w, task)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || t.ctx.Err() != nil {
+			slog.Warn("Task interrupted", "task", task.Description)
+
+			t.updateTaskStatus(task, TaskStatusInterrupted)
+
+			return
+		}
+
+		t.handleFailure(task, err)
+
+		return
+	}
+
+	t.mu.Lock()
+	task.Error = ""
+
+	if task.Report == nil {
+		task.Report = &TaskReport{
+			Summary:    message,
+			ReportedAt: time.Now(),
+		}
+	}
+
+	t.setTaskStatus(task, TaskStatusCompleted)
+	t.queueReport(task)
+	t.mu.Unlock()
+
+	t.SaveState()
 }
 
-func (t *TaskScheduler) executeTask(agentName string, task *Task) error {
-	agent := t.Agents[agentName]
+// handleFailure records the error on the task and either schedules it again
+// according to the retry policy of its assignee or marks it as failed.
+func (t *TaskScheduler) handleFailure(task *Task, err error) {
+	policy := t.retryPolicy(task.AssignedTo)
+
+	t.mu.Lock()
+
+	task.Attempts++
+	task.Error = err.Error()
+
+	if shouldRetry(policy, task.Attempts, err) {
+		delay := backoff(policy, task.Attempts)
+
+		slog.Warn("Task execution failed, retrying", "task", task.Description, "attempt", task.Attempts, "retry in", delay, "error", err)
 
-	if agent == nil {
-		return fmt.Errorf("agent not found")
+		task.NextAttemptAt = time.Now().Add(delay)
+		t.setTaskStatus(task, TaskStatusPending)
+	} else {
+		slog.Error("Task execution failed", "task", task.Description, "attempts", task.Attempts, "error", err)
+
+		t.setTaskStatus(task, TaskStatusFailed)
+		t.queueReport(task)
 	}
 
-	slog.Info("Executing task", "task", task.Description, "assigned to", agentName)
+	t.mu.Unlock()
+
+	t.SaveState()
+}
+
+// executeTask runs the task on the worker and returns the final message of
+// the agent.
+func (t *TaskScheduler) executeTask(w *worker, task *Task) (string, error) {
+	slog.Info("Executing task", "task", task.Description, "assigned to", w.name)
+
+	ctx := withTaskID(t.ctx, task.ID)
 
-	resp, err := agent.Chat(t.ctx, task.Description)
+	resp, err := w.agent.ChatWithTools(ctx, task.Description, t.ToolExecutor(task.AssignedTo))
 	if err != nil {
-		return fmt.Errorf("error executing task: %w", err)
+		return "", fmt.Errorf("error executing task: %w", err)
 	}
 
 	if resp.Message != "" {
 		slog.Debug("The response from the agent is: ", "response", resp.Message)
 	}
 
-	if len(resp.ToolsCalls) > 0 {
-		slog.Debug("The tools calls from the agent are: ", "toolsCalls", resp.ToolsCalls)
+	return resp.Message, nil
+}
 
-		for _, toolCall := range resp.ToolsCalls {
-			_, err := t.ToolCaller.Call(toolCall.Function.Name, toolCall.Function.Arguments)
-			if err != nil {
-				slog.Error("Error calling tool:", "error", err)
+// ToolExecutor returns the function an agent uses to run its tool calls,
+// recording each call in the persisted state.
+func (t *TaskScheduler) ToolExecutor(agentName string) agent.ToolExecutor {
+	return func(ctx context.Context, name string, args map[string]any) (string, error) {
+		result, err := t.ToolCaller.Call(ctx, agentName, name, args)
+
+		// Shortened like the audit log, the whole state is rewritten after
+		// every call and the full values are in the agent histories already
+		record := ToolCallRecord{
+			Agent:     agentName,
+			Tool:      name,
+			Arguments: shortenArguments(args),
+			Result:    shorten(result),
+			CalledAt:  time.Now(),
+		}
 
-				return fmt.Errorf("error calling tool: %w", err)
-			}
+		if err != nil {
+			record.Error = shorten(err.Error())
 		}
+
+		t.mu.Lock()
+		t.toolCalls = append(t.toolCalls, record)
+		t.mu.Unlock()
+
+		t.SaveState()
+
+		return result, err
 	}
+}
 
-	if err := t.updateTaskStatus(task, TaskStatusCompleted); err != nil {
-		slog.Error("Failed to update task status to completed", "task", task.Description, "error", err)
+// Restore rehydrates the scheduler and its agents from a saved state. Tasks
+// left in progress by the previous run are marked as interrupted so they are
+// scheduled again.
+func (t *TaskScheduler) Restore(state *State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-		return fmt.Errorf("failed to update task status to completed: %w", err)
+	for _, task := range state.Tasks {
+		if task.Status == TaskStatusInProgress {
+			task.Status = TaskStatusInterrupted
+		}
 	}
 
-	return nil
+	t.Tasks = state.Tasks
+	t.toolCalls = state.ToolCalls
+	t.reviews = state.Reviews
+	t.goalComplete = state.GoalComplete
+	t.pendingReports = state.PendingReports
+
+	if cycle := findCycle(t.Tasks); cycle != nil {
+		slog.Error("Dependency cycle detected, failing tasks", "tasks", cycle)
+
+		for _, id := range cycle {
+			if task := t.findTask(id); task != nil && task.Status != TaskStatusCompleted {
+				t.setTaskStatus(task, TaskStatusFailed)
+			}
+		}
+	}
+
+	for _, workers := range t.workers {
+		for _, w := range workers {
+			if history := state.Histories[w.name]; len(history) > 0 {
+				w.agent.SetHistory(history)
+			}
+		}
+	}
 }
 
-func (t *TaskScheduler) checkForInProgressTasks() bool {
+// SaveState persists the tasks, tool calls, review progress and agent
+// histories. Failures are logged rather than returned so a full disk doesn't
+// stop the run.
+func (t *TaskScheduler) SaveState() {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	state := &State{
+		Histories: map[string][]api.Message{},
+	}
+
+	t.mu.Lock()
+
 	for _, task := range t.Tasks {
-		if task.Status == TaskStatusInProgress {
-			return true
+		snapshot := *task
+		state.Tasks = append(state.Tasks, &snapshot)
+	}
+
+	state.ToolCalls = append([]ToolCallRecord(nil), t.toolCalls...)
+	state.Reviews = t.reviews
+	state.GoalComplete = t.goalComplete
+	state.PendingReports = append([]string(nil), t.pendingReports...)
+
+	for _, workers := range t.workers {
+		for _, w := range workers {
+			state.Histories[w.name] = w.agent.History()
 		}
 	}
 
-	return false
+	t.mu.Unlock()
+
+	if err := t.Store.Save(state); err != nil {
+		slog.Error("Failed to save state", "path", t.Store.Path(), "error", err)
+	}
 }
 
-func (t *TaskScheduler) getNextPendingTask() *Task {
-	for _, task := range t.Tasks {
-		if task.Status == TaskStatusPending {
-			return task
+// propagateFailures fails every runnable task that depends, directly or
+// transitively, on a failed task. It must be called with t.mu held.
+func (t *TaskScheduler) propagateFailures() bool {
+	changed := false
+
+	for {
+		failed := false
+
+		for _, task := range t.Tasks {
+			if !isRunnable(task) {
+				continue
+			}
+
+			if _, dependency := t.dependencyState(task); dependency != nil {
+				slog.Warn("Dependency failed, failing task", "task", task.Description, "dependency", dependency.Description)
+
+				task.Error = fmt.Sprintf("dependency %s failed", dependency.ID)
+				t.setTaskStatus(task, TaskStatusFailed)
+				failed = true
+			}
 		}
+
+		if !failed {
+			return changed
+		}
+
+		changed = true
 	}
+}
 
-	return nil
+func (t *TaskScheduler) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
 }
 
-func (t *TaskScheduler) updateTaskStatus(task *Task, status TaskStatus) error {
+func (t *TaskScheduler) updateTaskStatus(task *Task, status TaskStatus) {
+	t.mu.Lock()
+	t.setTaskStatus(task, status)
+	t.mu.Unlock()
+
+	t.SaveState()
+}
+
+// setTaskStatus must be called with t.mu held.
+func (t *TaskScheduler) setTaskStatus(task *Task, status TaskStatus) {
 	task.Status = status
 	task.UpdatedAt = time.Now()
+}
+
+func isRunnable(task *Task) bool {
+	return task.Status == TaskStatusPending || task.Status == TaskStatusInterrupted
+}
+
+func idleWorker(workers []*worker) *worker {
+	for _, w := range workers {
+		if !w.busy {
+			return w
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,193 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/agent"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+	"github.com/ollama/ollama/api"
+)
+
+func TestStopWaitsForStartedRun(t *testing.T) {
+	for range 100 {
+		scheduler := NewTaskScheduler(t.Context(), nil, t.TempDir())
+
+		if err := scheduler.AddTask(&Task{Description: "build the server", AssignedTo: "backend-developer"}); err != nil {
+			t.Fatal(err)
+		}
+
+		done := scheduler.Start()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		if err := scheduler.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		cancel()
+
+		select {
+		case <-done:
+		default:
+			t.Fatal("expected Stop to wait for the run to return")
+		}
+	}
+}
+
+func TestAssignTaskRejectsUnknownAssignee(t *testing.T) {
+	scheduler := NewTaskScheduler(t.Context(), map[string]*agent.Agent{
+		"frontend-developer": {},
+		"backend-developer":  {},
+	}, t.TempDir())
+
+	_, err := scheduler.ToolCaller.assignTask(t.Context(), map[string]any{
+		"task":     "build the server",
+		"assignee": "backend-dev",
+	})
+	if err == nil {
+		t.Fatal("expected an unknown assignee to be rejected")
+	}
+
+	if !strings.Contains(err.Error(), "backend-developer, frontend-developer") {
+		t.Fatalf("expected the error to list the agents, got %v", err)
+	}
+
+	if len(scheduler.Tasks) != 0 {
+		t.Fatalf("expected no task to be added, got %d", len(scheduler.Tasks))
+	}
+
+	if _, err := scheduler.ToolCaller.assignTask(t.Context(), map[string]any{
+		"task":     "build the server",
+		"assignee": "backend-developer",
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// concurrencyClient answers every request after a while, recording how many
+// requests it served at once.
+type concurrencyClient struct {
+	active *atomic.Int32
+	peak   *atomic.Int32
+}
+
+func newConcurrencyClient() *concurrencyClient {
+	return &concurrencyClient{active: &atomic.Int32{}, peak: &atomic.Int32{}}
+}
+
+func (c *concurrencyClient) Chat(ctx context.Context, req *api.ChatRequest, fn api.ChatResponseFunc) error {
+	active := c.active.Add(1)
+	defer c.active.Add(-1)
+
+	for {
+		peak := c.peak.Load()
+		if active <= peak || c.peak.CompareAndSwap(peak, active) {
+			break
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	return fn(api.ChatResponse{
+		Message: api.Message{Role: "assistant", Content: "done"},
+		Done:    true,
+	})
+}
+
+// runTasks runs count tasks for each agent and waits for the run to end.
+func runTasks(t *testing.T, scheduler *TaskScheduler, count int) {
+	t.Helper()
+
+	for name := range scheduler.Agents {
+		for i := range count {
+			if err := scheduler.AddTask(&Task{Description: fmt.Sprintf("task %d", i), AssignedTo: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	select {
+	case err := <-scheduler.Start():
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the run to end")
+	}
+
+	for _, task := range scheduler.GetTasks() {
+		if task.Status != TaskStatusCompleted {
+			t.Fatalf("expected every task to complete, %s is %s", task.Description, task.Status)
+		}
+	}
+}
+
+func TestDispatchRespectsMaxConcurrency(t *testing.T) {
+	client := newConcurrencyClient()
+
+	agents := map[string]*agent.Agent{}
+
+	for _, name := range []string{"backend-developer", "frontend-developer"} {
+		agents[name] = &agent.Agent{Config: config.Agent{Name: name, Concurrency: 3}, Client: client}
+	}
+
+	scheduler := NewTaskScheduler(t.Context(), agents, t.TempDir())
+	scheduler.MaxConcurrency = 2
+
+	runTasks(t, scheduler, 4)
+
+	if peak := client.peak.Load(); peak != 2 {
+		t.Fatalf("expected 2 tasks to run at once, %d did", peak)
+	}
+}
+
+func TestDispatchUsesAgentWorkers(t *testing.T) {
+	clients := map[string]*concurrencyClient{}
+	agents := map[string]*agent.Agent{}
+
+	for name, concurrency := range map[string]int{"backend-developer": 3, "frontend-developer": 1} {
+		clients[name] = newConcurrencyClient()
+		agents[name] = &agent.Agent{Config: config.Agent{Name: name, Concurrency: concurrency}, Client: clients[name]}
+	}
+
+	scheduler := NewTaskScheduler(t.Context(), agents, t.TempDir())
+
+	runTasks(t, scheduler, 6)
+
+	for name, concurrency := range map[string]int32{"backend-developer": 3, "frontend-developer": 1} {
+		if peak := clients[name].peak.Load(); peak != concurrency {
+			t.Fatalf("expected %s to run %d tasks at once, it ran %d", name, concurrency, peak)
+		}
+	}
+
+	// Every worker keeps its own conversation, one task after the other
+	state, err := scheduler.Store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := 0
+
+	for name, history := range state.Histories {
+		for i, message := range history {
+			if message.Role != "user" {
+				continue
+			}
+
+			tasks++
+
+			if i+1 == len(history) || history[i+1].Role != "assistant" {
+				t.Fatalf("expected the task sent to %s to be answered before the next one, got %v", name, history)
+			}
+		}
+	}
+
+	if tasks != 12 {
+		t.Fatalf("expected the histories to hold the 12 tasks, got %d", tasks)
+	}
+}
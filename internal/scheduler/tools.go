@@ -1,87 +1,302 @@
 package scheduler
 
 import (
-	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"strings"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/approval"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
 )
 
 type ToolCaller struct {
-	Tools         map[string]func(args map[string]any) (string, error)
+	Tools         map[string]Tool
 	TaskScheduler *TaskScheduler
+	Commands      config.Commands
+	Approval      *approval.Policy
 }
 
 func NewToolCaller(taskScheduler *TaskScheduler) *ToolCaller {
 	t := &ToolCaller{
+		Tools:         map[string]Tool{},
 		TaskScheduler: taskScheduler,
 	}
 
-	toolsFuncMap := map[string]func(args map[string]any) (string, error){
-		"assign-task": func(args map[string]any) (string, error) {
-			return t.assignTask(args)
+	builtins := map[string]describedToolFunc{
+		"assign-task": {
+			ToolFunc: t.assignTask,
+			parameters: parameters([]string{"task", "assignee"}, map[string]string{
+				"task":       "string",
+				"assignee":   "string",
+				"depends_on": "array",
+			}),
+		},
+		"run-command": {
+			ToolFunc: t.runCommand,
+			parameters: parameters(nil, map[string]string{
+				"command":           "string",
+				"argv":              "array",
+				"shell":             "boolean",
+				"timeout_seconds":   "number",
+				"working_directory": "string",
+			}),
+		},
+		"write-file": {
+			ToolFunc: t.writeFile,
+			parameters: parameters([]string{"file", "content"}, map[string]string{
+				"file":    "string",
+				"content": "string",
+				"mode":    "string",
+			}),
 		},
-		"run-command": func(args map[string]any) (string, error) {
-			return t.runCommand(args)
+		"read-file": {
+			ToolFunc: t.readFile,
+			parameters: parameters([]string{"file"}, map[string]string{
+				"file":   "string",
+				"offset": "integer",
+				"limit":  "integer",
+			}),
 		},
-		"write-file": func(args map[string]any) (string, error) {
-			return t.writeFile(args)
+		"list-files": {
+			ToolFunc: t.listFiles,
+			parameters: parameters(nil, map[string]string{
+				"working_directory": "string",
+				"recursive":         "boolean",
+				"max_depth":         "integer",
+				"pattern":           "string",
+			}),
 		},
-		"read-file": func(args map[string]any) (string, error) {
-			return t.readFile(args)
+		"edit-file": {
+			ToolFunc: t.editFile,
+			parameters: parameters([]string{"file"}, map[string]string{
+				"file":        "string",
+				"search":      "string",
+				"replace":     "string",
+				"replace_all": "boolean",
+				"start_line":  "integer",
+				"end_line":    "integer",
+				"content":     "string",
+				"patch":       "string",
+			}),
 		},
-		"list-files": func(args map[string]any) (string, error) {
-			return t.listFiles(args)
+		"search-files": {
+			ToolFunc: t.searchFiles,
+			parameters: parameters([]string{"query"}, map[string]string{
+				"query":             "string",
+				"regex":             "boolean",
+				"case_sensitive":    "boolean",
+				"include":           "string",
+				"exclude":           "string",
+				"working_directory": "string",
+				"context_lines":     "integer",
+			}),
 		},
-		"edit-file": func(args map[string]any) (string, error) {
-			return t.editFile(args)
+		"complete-task": {
+			ToolFunc: t.completeTask,
+			parameters: parameters([]string{"summary"}, map[string]string{
+				"summary":   "string",
+				"artifacts": "array",
+			}),
 		},
 	}
 
-	t.Tools = toolsFuncMap
+	for name, tool := range builtins {
+		t.Tools[name] = tool
+	}
 
 	return t
 }
 
-func (t *ToolCaller) Call(toolName string, args map[string]any) (string, error) {
-	if _, ok := t.Tools[toolName]; !ok {
+// Call runs a tool on behalf of the given agent. The call is rejected if
+// the agent wasn't granted the tool in its config, and its arguments are
+// validated against the declared schema. A panicking tool is reported as an
+// error instead of crashing the process. Every call is audited.
+func (t *ToolCaller) Call(ctx context.Context, agentName string, toolName string, args map[string]any) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Tool panicked", "tool", toolName, "panic", r, "stack", string(debug.Stack()))
+
+			result = ""
+			err = fmt.Errorf("tool %s failed unexpectedly: %v", toolName, r)
+		}
+
+		t.audit(agentName, toolName, args, err)
+	}()
+
+	tool, ok := t.Tools[toolName]
+	if !ok {
 		return "", fmt.Errorf("tool %s not found", toolName)
 	}
 
-	return t.Tools[toolName](args)
+	schema, ok := t.schema(agentName, toolName)
+	if !ok {
+		return "", &PermissionError{Agent: agentName, Tool: toolName}
+	}
+
+	if err := validateArguments(toolName, schema, args); err != nil {
+		return "", err
+	}
+
+	return tool.Call(withAgentName(ctx, agentName), args)
+}
+
+// schema returns the parameters of the tool as declared by the agent, and
+// whether the agent was granted the tool at all.
+func (t *ToolCaller) schema(agentName string, toolName string) (config.Parameter, bool) {
+	a, ok := t.TaskScheduler.Agents[agentName]
+	if !ok {
+		return config.Parameter{}, false
+	}
+
+	for _, tool := range a.Config.Tools {
+		if tool.Function != nil && tool.Function.Name == toolName {
+			return tool.Function.Parameters, true
+		}
+	}
+
+	return config.Parameter{}, false
 }
 
-func (t *ToolCaller) assignTask(args map[string]any) (string, error) {
+func (t *ToolCaller) assignTask(ctx context.Context, args map[string]any) (string, error) {
 	assignee := args["assignee"].(string)
 	taskDescription := args["task"].(string)
 
+	if err := t.TaskScheduler.checkAssignee(assignee); err != nil {
+		return "", err
+	}
+
 	task := &Task{
 		Description: taskDescription,
 		AssignedTo:  assignee,
 	}
 
-	t.TaskScheduler.AddTask(task)
+	if args["depends_on"] != nil {
+		dependsOn, ok := args["depends_on"].([]any)
+		if !ok {
+			return "", fmt.Errorf("depends_on must be an array of task IDs")
+		}
+
+		for _, id := range dependsOn {
+			id, ok := id.(string)
+			if !ok {
+				return "", fmt.Errorf("depends_on must be an array of task IDs")
+			}
 
-	return "", nil
+			task.DependsOn = append(task.DependsOn, id)
+		}
+	}
+
+	if err := t.TaskScheduler.AddTask(task); err != nil {
+		return "", fmt.Errorf("error assigning task: %w", err)
+	}
+
+	return fmt.Sprintf("task %s assigned to %s", task.ID, assignee), nil
 }
 
-func (t *ToolCaller) runCommand(args map[string]any) (string, error) {
+func (t *ToolCaller) completeTask(ctx context.Context, args map[string]any) (string, error) {
+	taskID, ok := taskIDFromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("complete-task can only be called while working on a task")
+	}
+
+	summary, ok := args["summary"].(string)
+	if !ok {
+		return "", fmt.Errorf("summary is required and must be a string")
+	}
+
+	report := &TaskReport{
+		Summary: summary,
+	}
+
+	if args["artifacts"] != nil {
+		artifacts, ok := args["artifacts"].([]any)
+		if !ok {
+			return "", fmt.Errorf("artifacts must be an array of file paths")
+		}
+
+		for _, artifact := range artifacts {
+			artifact, ok := artifact.(string)
+			if !ok {
+				return "", fmt.Errorf("artifacts must be an array of file paths")
+			}
+
+			report.Artifacts = append(report.Artifacts, artifact)
+		}
+	}
+
+	if err := t.TaskScheduler.ReportTask(taskID, report); err != nil {
+		return "", fmt.Errorf("error reporting task: %w", err)
+	}
+
+	return "report saved, it will be sent to the project manager once you finish", nil
+}
+
+func (t *ToolCaller) runCommand(ctx context.Context, args map[string]any) (string, error) {
 	workingDirectory := t.TaskScheduler.OutputFolder
 
-	if args["command"] == nil {
-		return "", fmt.Errorf("command is required")
+	req := CommandRequest{}
+
+	if shell, ok := args["shell"].(bool); ok {
+		req.Shell = shell
 	}
 
-	command := args["command"].(string)
+	switch {
+	case args["argv"] != nil:
+		argv, ok := args["argv"].([]any)
+		if !ok {
+			return "", fmt.Errorf("argv must be an array of strings")
+		}
+
+		for _, arg := range argv {
+			arg, ok := arg.(string)
+			if !ok {
+				return "", fmt.Errorf("argv must be an array of strings")
+			}
+
+			req.Argv = append(req.Argv, arg)
+		}
+
+		// Keep the arguments intact when they go through the shell
+		if req.Shell {
+			req.Argv = []string{shellJoin(req.Argv)}
+		}
+	case args["command"] != nil:
+		command := args["command"].(string)
+
+		if req.Shell {
+			req.Argv = []string{command}
+		} else {
+			argv, err := splitCommand(command)
+			if err != nil {
+				return "", err
+			}
+
+			req.Argv = argv
+		}
+	default:
+		return "", fmt.Errorf("command or argv is required")
+	}
+
+	if timeout, ok := args["timeout_seconds"].(float64); ok && timeout > 0 {
+		req.Timeout = time.Duration(timeout * float64(time.Second))
+	}
 
 	if args["working_directory"] != nil {
 		requestedWorkingDirectory := args["working_directory"].(string)
 
 		// requested should be relative to the output folder
-		requestedWorkingDirectory = filepath.Join(workingDirectory, requestedWorkingDirectory)
+		requestedWorkingDirectory, err := t.resolvePath(requestedWorkingDirectory)
+		if err != nil {
+			return "", err
+		}
 
 		if _, err := os.Stat(requestedWorkingDirectory); os.IsNotExist(err) {
 			return "", fmt.Errorf("working directory does not exist")
@@ -90,41 +305,45 @@ func (t *ToolCaller) runCommand(args map[string]any) (string, error) {
 		workingDirectory = requestedWorkingDirectory
 	}
 
-	slog.Info("Asking permission to run command", "command", command, "working_directory", workingDirectory)
+	req.Dir = workingDirectory
 
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		slog.Info("Type 'YES' to run the command or 'NO' to skip:")
-		input, _ := reader.ReadString('\n') //nolint:errcheck
-		input = strings.TrimSpace(input)
+	command := strings.Join(req.Argv, " ")
 
-		switch input {
-		case "YES":
-			slog.Info("Running command", "command", command, "working_directory", workingDirectory)
+	if t.Approval == nil {
+		return "", fmt.Errorf("no command approval policy configured")
+	}
 
-			c := strings.Split(command, " ")
+	decision, err := t.Approval.Evaluate(ctx, approval.Request{
+		Agent:            agentNameFromContext(ctx),
+		Command:          command,
+		Argv:             req.Argv,
+		Shell:            req.Shell,
+		WorkingDirectory: workingDirectory,
+	})
+	if err != nil {
+		return "", err
+	}
 
-			cmd := exec.Command(c[0], c[1:]...)
-			cmd.Dir = workingDirectory
-			output, err := cmd.Output()
-			if err != nil {
-				return "", fmt.Errorf("error running command: %w", err)
-			}
+	if !decision.Approved {
+		return "", fmt.Errorf("command rejected: %s", decision.Reason)
+	}
 
-			slog.Info("Command output", "output", string(output))
+	slog.Info("Running command", "command", command, "working_directory", workingDirectory)
 
-			return string(output), nil
-		case "NO":
-			return "", fmt.Errorf("command execution skipped by user")
-		default:
-			slog.Info("Invalid input. Please type 'YES' or 'NO'")
-		}
+	result, err := runProcess(ctx, t.Commands, req)
+	if err != nil {
+		return "", err
 	}
-}
 
-func (t *ToolCaller) writeFile(args map[string]any) (string, error) {
-	workingDirectory := t.TaskScheduler.OutputFolder
+	slog.Info("Command output", "exit code", result.ExitCode, "output", result.Output)
+
+	return result.String(), nil
+}
 
+// writeFile writes the whole file, creating its parent directories. The
+// optional mode restricts the write to new files ("create") or existing
+// ones ("overwrite").
+func (t *ToolCaller) writeFile(ctx context.Context, args map[string]any) (string, error) {
 	if args["file"] == nil {
 		return "", fmt.Errorf("file is required")
 	}
@@ -137,43 +356,161 @@ func (t *ToolCaller) writeFile(args map[string]any) (string, error) {
 
 	content := args["content"].(string)
 
-	filePath := filepath.Join(workingDirectory, file)
+	mode := "any"
+	if args["mode"] != nil {
+		mode = args["mode"].(string)
+	}
 
-	err := os.WriteFile(filePath, []byte(content), 0644)
+	filePath, err := t.resolvePath(file)
 	if err != nil {
-		return "", fmt.Errorf("error writing file: %w", err)
+		return "", err
+	}
+
+	previous, err := os.ReadFile(filePath)
+	exists := err == nil
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("error reading existing file: %w", err)
+	}
+
+	switch mode {
+	case "any":
+	case "create":
+		if exists {
+			return "", fmt.Errorf("file %s already exists, use mode \"overwrite\" or edit-file to change it", file)
+		}
+	case "overwrite":
+		if !exists {
+			return "", fmt.Errorf("file %s does not exist, use mode \"create\" to create it", file)
+		}
+	default:
+		return "", fmt.Errorf("invalid mode %q, expected any, create or overwrite", mode)
 	}
 
-	return "", nil
+	if err := t.writeFileAt(filePath, []byte(content)); err != nil {
+		return "", err
+	}
+
+	if !exists {
+		return fmt.Sprintf("created %s, wrote %d bytes", file, len(content)), nil
+	}
+
+	return fmt.Sprintf("overwrote %s, wrote %d bytes (previously %d bytes, sha256 %x)", file, len(content), len(previous), sha256.Sum256(previous)), nil
 }
 
-func (t *ToolCaller) readFile(args map[string]any) (string, error) {
-	workingDirectory := t.TaskScheduler.OutputFolder
+const (
+	defaultReadLimit = 500
+	maxReadFileSize  = 10 * 1024 * 1024
+	maxReadBytes     = 64 * 1024
+	maxReadLineSize  = 2000
+)
 
+// readFile returns a line numbered range of a text file, by default its
+// first lines, together with the total line count.
+func (t *ToolCaller) readFile(ctx context.Context, args map[string]any) (string, error) {
 	if args["file"] == nil {
 		return "", fmt.Errorf("file is required")
 	}
 
 	file := args["file"].(string)
 
-	filePath := filepath.Join(workingDirectory, file)
+	filePath, err := t.resolvePath(file)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory, use list-files to see its content", file)
+	}
+
+	if info.Size() > maxReadFileSize {
+		return "", fmt.Errorf("%s is too large to read (%d bytes), use search-files to find the relevant lines", file, info.Size())
+	}
 
 	content, err := os.ReadFile(filePath)
 	if err != nil {
 		return "", fmt.Errorf("error reading file: %w", err)
 	}
 
-	return string(content), nil
+	if isBinary(content) {
+		return "", fmt.Errorf("%s is a binary file (%d bytes) and can't be read as text", file, len(content))
+	}
+
+	offset := 1
+	if n, ok := args["offset"].(float64); ok && n > 1 {
+		offset = int(n)
+	}
+
+	limit := defaultReadLimit
+	if n, ok := args["limit"].(float64); ok && n > 0 {
+		limit = int(n)
+	}
+
+	lines, _ := splitLines(string(content))
+
+	if len(lines) == 0 {
+		return fmt.Sprintf("%s is empty", file), nil
+	}
+
+	if offset > len(lines) {
+		return "", fmt.Errorf("offset %d is past the end of %s, which has %d lines", offset, file, len(lines))
+	}
+
+	var output strings.Builder
+
+	last := offset - 1
+	for i := offset - 1; i < len(lines) && i < offset-1+limit; i++ {
+		line := lines[i]
+		if len(line) > maxReadLineSize {
+			line = line[:maxReadLineSize] + "... [line truncated]"
+		}
+
+		if output.Len()+len(line) > maxReadBytes {
+			break
+		}
+
+		fmt.Fprintf(&output, "%6d\t%s\n", i+1, line)
+		last = i + 1
+	}
+
+	header := fmt.Sprintf("%s: %d lines in total, showing lines %d-%d\n", file, len(lines), offset, last)
+
+	if last < len(lines) {
+		fmt.Fprintf(&output, "[%d more lines, read them with offset %d]\n", len(lines)-last, last+1)
+	}
+
+	return header + output.String(), nil
 }
 
-func (t *ToolCaller) listFiles(args map[string]any) (string, error) {
-	workingDirectory := t.TaskScheduler.OutputFolder
+const (
+	defaultListDepth = 5
+	maxListEntries   = 500
+)
+
+// listFiles lists a directory of the workspace, optionally recursively and
+// filtered by a glob. Directories end with a slash, files show their size,
+// and ignored entries such as node_modules are skipped.
+func (t *ToolCaller) listFiles(ctx context.Context, args map[string]any) (string, error) {
+	root, err := t.workspaceRoot()
+	if err != nil {
+		return "", fmt.Errorf("error resolving workspace root: %w", err)
+	}
+
+	workingDirectory := root
 
 	if args["working_directory"] != nil {
 		requestedWorkingDirectory := args["working_directory"].(string)
 
 		// requested should be relative to the output folder
-		requestedWorkingDirectory = filepath.Join(workingDirectory, requestedWorkingDirectory)
+		requestedWorkingDirectory, err := t.resolvePath(requestedWorkingDirectory)
+		if err != nil {
+			return "", err
+		}
 
 		if _, err := os.Stat(requestedWorkingDirectory); os.IsNotExist(err) {
 			return "", fmt.Errorf("working directory does not exist")
@@ -182,40 +519,168 @@ func (t *ToolCaller) listFiles(args map[string]any) (string, error) {
 		workingDirectory = requestedWorkingDirectory
 	}
 
-	files, err := os.ReadDir(workingDirectory)
+	maxDepth := 1
+	if recursive, _ := args["recursive"].(bool); recursive {
+		maxDepth = defaultListDepth
+	}
+
+	if depth, ok := args["max_depth"].(float64); ok && depth > 0 {
+		maxDepth = int(depth)
+	}
+
+	var (
+		pattern  *regexp.Regexp
+		hasSlash bool
+	)
+
+	if glob, ok := args["pattern"].(string); ok && glob != "" {
+		pattern, err = globToRegexp(glob)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern %q: %w", glob, err)
+		}
+
+		hasSlash = strings.Contains(glob, "/")
+	}
+
+	filesList := []string{}
+	skipped := 0
+
+	err = walkWorkspace(root, workingDirectory, maxDepth, func(e walkEntry) error {
+		if pattern != nil && (e.entry.IsDir() || !matchGlob(pattern, hasSlash, e.rel)) {
+			return nil
+		}
+
+		if len(filesList) >= maxListEntries {
+			skipped++
+
+			return nil
+		}
+
+		if e.entry.IsDir() {
+			filesList = append(filesList, e.rel+"/")
+
+			return nil
+		}
+
+		info, err := e.entry.Info()
+		if err != nil {
+			filesList = append(filesList, e.rel)
+
+			return nil
+		}
+
+		filesList = append(filesList, fmt.Sprintf("%s (%d bytes)", e.rel, info.Size()))
+
+		return nil
+	})
 	if err != nil {
 		return "", fmt.Errorf("error listing files: %w", err)
 	}
 
-	filesList := []string{}
-	for _, file := range files {
-		filesList = append(filesList, file.Name())
+	if len(filesList) == 0 {
+		return "no files found", nil
+	}
+
+	if skipped > 0 {
+		filesList = append(filesList, fmt.Sprintf("... %d more entries not shown, narrow the listing with working_directory, max_depth or pattern", skipped))
 	}
 
 	return strings.Join(filesList, "\n"), nil
 }
 
-func (t *ToolCaller) editFile(args map[string]any) (string, error) {
-	workingDirectory := t.TaskScheduler.OutputFolder
-
+// editFile applies a targeted edit to an existing file: a search/replace, a
+// line range replacement or a unified diff.
+func (t *ToolCaller) editFile(ctx context.Context, args map[string]any) (string, error) {
 	if args["file"] == nil {
 		return "", fmt.Errorf("file is required")
 	}
 
 	file := args["file"].(string)
 
-	if args["content"] == nil {
-		return "", fmt.Errorf("content is required")
+	filePath, err := t.resolvePath(file)
+	if err != nil {
+		return "", err
 	}
 
-	content := args["content"].(string)
+	original, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
 
-	filePath := filepath.Join(workingDirectory, file)
+	var (
+		edited  string
+		summary string
+	)
 
-	err := os.WriteFile(filePath, []byte(content), 0644)
-	if err != nil {
-		return "", fmt.Errorf("error writing file: %w", err)
+	switch {
+	case args["search"] != nil:
+		search, ok := args["search"].(string)
+		if !ok {
+			return "", fmt.Errorf("search must be a string")
+		}
+
+		// Required, so a forgotten replacement doesn't delete the text
+		replacement, ok := args["replace"].(string)
+		if !ok {
+			return "", fmt.Errorf("replace is required with search and must be a string, use \"\" to delete the text")
+		}
+
+		all, _ := args["replace_all"].(bool)
+
+		var count int
+
+		edited, count, err = replaceText(string(original), search, replacement, all)
+		if err != nil {
+			return "", err
+		}
+
+		summary = fmt.Sprintf("replaced %d occurrence(s) in %s", count, file)
+	case args["start_line"] != nil:
+		start, ok := args["start_line"].(float64)
+		if !ok {
+			return "", fmt.Errorf("start_line must be a number")
+		}
+
+		end := start
+		if args["end_line"] != nil {
+			end, ok = args["end_line"].(float64)
+			if !ok {
+				return "", fmt.Errorf("end_line must be a number")
+			}
+		}
+
+		content, ok := args["content"].(string)
+		if !ok {
+			return "", fmt.Errorf("content is required when replacing a line range")
+		}
+
+		edited, err = replaceLines(string(original), int(start), int(end), content)
+		if err != nil {
+			return "", err
+		}
+
+		summary = fmt.Sprintf("replaced lines %d-%d in %s", int(start), int(end), file)
+	case args["patch"] != nil:
+		patch, ok := args["patch"].(string)
+		if !ok {
+			return "", fmt.Errorf("patch must be a string containing a unified diff")
+		}
+
+		var count int
+
+		edited, count, err = applyUnifiedDiff(string(original), patch)
+		if err != nil {
+			return "", err
+		}
+
+		summary = fmt.Sprintf("applied %d hunk(s) to %s", count, file)
+	default:
+		return "", fmt.Errorf("one of search, start_line or patch is required, use write-file to replace the whole file")
+	}
+
+	if err := t.writeFileAt(filePath, []byte(edited)); err != nil {
+		return "", err
 	}
 
-	return "", nil
+	return summary, nil
 }
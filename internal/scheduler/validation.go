@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// ValidationError lists everything wrong with the arguments of a tool call,
+// so the model can fix them all in its next attempt.
+type ValidationError struct {
+	Tool     string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid arguments for tool %s: %s", e.Tool, strings.Join(e.Problems, "; "))
+}
+
+// validateArguments checks args against the declared schema: required
+// parameters, types, array items and enums. Undeclared arguments are
+// ignored.
+func validateArguments(tool string, schema config.Parameter, args map[string]any) error {
+	problems := []string{}
+
+	for _, name := range schema.Required {
+		if value, ok := args[name]; !ok || value == nil {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok || args[name] == nil {
+			continue
+		}
+
+		value := args[name]
+
+		if property.Type != "" && !hasType(value, property.Type) {
+			problems = append(problems, fmt.Sprintf("%s must be of type %s, got %s", name, property.Type, typeName(value)))
+
+			continue
+		}
+
+		if itemType := itemsType(property.Items); itemType != "" {
+			if items, ok := value.([]any); ok {
+				for i, item := range items {
+					if !hasType(item, itemType) {
+						problems = append(problems, fmt.Sprintf("%s[%d] must be of type %s, got %s", name, i, itemType, typeName(item)))
+					}
+				}
+			}
+		}
+
+		if len(property.Enum) > 0 && !slices.ContainsFunc(property.Enum, func(allowed any) bool {
+			return fmt.Sprint(allowed) == fmt.Sprint(value)
+		}) {
+			problems = append(problems, fmt.Sprintf("%s must be one of %v, got %v", name, property.Enum, value))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Tool: tool, Problems: problems}
+	}
+
+	return nil
+}
+
+func hasType(value any, expected string) bool {
+	switch expected {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// itemsType returns the type of the items of an array property, declared
+// in the config as items: {type: ...}.
+func itemsType(items any) string {
+	switch items := items.(type) {
+	case map[string]any:
+		itemType, _ := items["type"].(string)
+		return itemType
+	case map[any]any:
+		itemType, _ := items["type"].(string)
+		return itemType
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+func TestValidateArguments(t *testing.T) {
+	schema := config.Parameter{
+		Type:     "object",
+		Required: []string{"file", "content"},
+		Properties: map[string]config.ParameterProperties{
+			"file":      {Type: "string"},
+			"content":   {Type: "string"},
+			"limit":     {Type: "integer"},
+			"ratio":     {Type: "number"},
+			"recursive": {Type: "boolean"},
+			"options":   {Type: "object"},
+			"artifacts": {Type: "array", Items: map[string]any{"type": "string"}},
+			"mode":      {Type: "string", Enum: []any{"create", "overwrite"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		args     map[string]any
+		problems []string
+	}{
+		{
+			name: "valid",
+			args: map[string]any{
+				"file":      "a.go",
+				"content":   "",
+				"limit":     float64(10),
+				"ratio":     0.5,
+				"recursive": true,
+				"options":   map[string]any{},
+				"artifacts": []any{"a.go"},
+				"mode":      "create",
+				"unknown":   1,
+			},
+		},
+		{
+			name:     "missing required",
+			args:     map[string]any{"content": nil},
+			problems: []string{"file is required", "content is required"},
+		},
+		{
+			name:     "wrong types",
+			args:     map[string]any{"file": 1.0, "content": []any{}, "recursive": "yes"},
+			problems: []string{"content must be of type string, got array", "file must be of type string, got number", "recursive must be of type boolean, got string"},
+		},
+		{
+			name:     "integer with a fraction",
+			args:     map[string]any{"file": "a", "content": "b", "limit": 1.5},
+			problems: []string{"limit must be of type integer, got number"},
+		},
+		{
+			name:     "array items",
+			args:     map[string]any{"file": "a", "content": "b", "artifacts": []any{"a.go", 2.0}},
+			problems: []string{"artifacts[1] must be of type string, got number"},
+		},
+		{
+			name:     "enum",
+			args:     map[string]any{"file": "a", "content": "b", "mode": "append"},
+			problems: []string{"mode must be one of [create overwrite], got append"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateArguments("write-file", schema, test.args)
+
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+
+			if !slices.Equal(validationErr.Problems, test.problems) {
+				t.Fatalf("expected %q, got %q", test.problems, validationErr.Problems)
+			}
+		})
+	}
+}
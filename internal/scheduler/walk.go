@@ -0,0 +1,253 @@
+package scheduler
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// alwaysIgnored are skipped whether or not a .gitignore mentions them.
+var alwaysIgnored = []string{".git", "node_modules", StateFileName}
+
+type ignoreRule struct {
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// anchored patterns match the whole path relative to base, the others
+	// only the name of the entry
+	anchored bool
+}
+
+// ignoreMatcher implements the subset of the .gitignore rules agents need:
+// comments, negation, directory-only and anchored patterns, and ** globs.
+type ignoreMatcher struct {
+	root  string
+	rules []ignoreRule
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	return &ignoreMatcher{root: root}
+}
+
+// load reads the .gitignore of the directory dir, relative to the root.
+func (m *ignoreMatcher) load(dir string) {
+	file, err := os.Open(filepath.Join(m.root, filepath.FromSlash(dir), ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer file.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: dir}
+
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		pattern, err := globToRegexp(line)
+		if err != nil {
+			continue
+		}
+
+		rule.pattern = pattern
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// ignored reports whether the entry at rel, relative to the root, is
+// ignored. Like git, the last matching rule wins.
+func (m *ignoreMatcher) ignored(rel string, isDir bool) bool {
+	name := path.Base(rel)
+
+	for _, always := range alwaysIgnored {
+		if name == always {
+			return true
+		}
+	}
+
+	ignored := false
+
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		target := rel
+		if rule.base != "." {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+
+			target = strings.TrimPrefix(rel, rule.base+"/")
+		}
+
+		if !rule.anchored {
+			target = name
+		}
+
+		if rule.pattern.MatchString(target) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// globToRegexp converts a glob, where * and ? don't cross directories and
+// ** matches any number of them, to an anchored regular expression.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+
+	b.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**"):
+			b.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+
+				continue
+			}
+
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// matchGlob matches a glob against the path of an entry relative to the
+// root, or against its name only if the glob has no slash.
+func matchGlob(pattern *regexp.Regexp, hasSlash bool, rel string) bool {
+	if hasSlash {
+		return pattern.MatchString(rel)
+	}
+
+	return pattern.MatchString(path.Base(rel))
+}
+
+type walkEntry struct {
+	// rel is the slash separated path relative to the workspace root
+	rel   string
+	depth int
+	entry fs.DirEntry
+}
+
+// walkWorkspace walks start, a directory inside root, skipping ignored
+// entries and not descending deeper than maxDepth levels (unlimited when
+// maxDepth is 0). Returning fs.SkipAll from fn stops the walk.
+func walkWorkspace(root string, start string, maxDepth int, fn func(walkEntry) error) error {
+	matcher := newIgnoreMatcher(root)
+
+	// Rules of the parent directories apply to start too
+	rel, err := filepath.Rel(root, start)
+	if err != nil {
+		return err
+	}
+
+	dir := "."
+	matcher.load(dir)
+
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if part == "." {
+			continue
+		}
+
+		dir = path.Join(dir, part)
+		matcher.load(dir)
+	}
+
+	return filepath.WalkDir(start, func(current string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if current == start {
+			return nil
+		}
+
+		relCurrent, err := filepath.Rel(root, current)
+		if err != nil {
+			return err
+		}
+
+		relCurrent = filepath.ToSlash(relCurrent)
+
+		relStart, err := filepath.Rel(start, current)
+		if err != nil {
+			return err
+		}
+
+		depth := len(strings.Split(filepath.ToSlash(relStart), "/"))
+
+		if matcher.ignored(relCurrent, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if err := fn(walkEntry{rel: relCurrent, depth: depth, entry: d}); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if maxDepth > 0 && depth >= maxDepth {
+				return filepath.SkipDir
+			}
+
+			matcher.load(relCurrent)
+		}
+
+		return nil
+	})
+}
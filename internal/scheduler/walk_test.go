@@ -0,0 +1,45 @@
+package scheduler
+
+import "testing"
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{glob: "*.go", path: "main.go", matches: true},
+		{glob: "*.go", path: "cmd/main.go"},
+		{glob: "*.go", path: "main.gox"},
+		{glob: "src/*.ts", path: "src/app.ts", matches: true},
+		{glob: "src/*.ts", path: "src/lib/app.ts"},
+		{glob: "**/*.go", path: "main.go", matches: true},
+		{glob: "**/*.go", path: "internal/agent/agent.go", matches: true},
+		{glob: "src/**", path: "src", matches: true},
+		{glob: "src/**", path: "src/a/b.txt", matches: true},
+		{glob: "src/**", path: "srcx/a.txt"},
+		{glob: "src/**/test.js", path: "src/test.js", matches: true},
+		{glob: "src/**/test.js", path: "src/a/b/test.js", matches: true},
+		{glob: "file?.txt", path: "file1.txt", matches: true},
+		{glob: "file?.txt", path: "file/.txt"},
+		{glob: "[abc].md", path: "b.md", matches: true},
+		{glob: "[!abc].md", path: "b.md"},
+		{glob: "[!abc].md", path: "d.md", matches: true},
+		{glob: "[.md", path: "[.md", matches: true},
+		{glob: "a.b+c", path: "a.b+c", matches: true},
+		{glob: "a.b+c", path: "axbbc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.glob+" "+test.path, func(t *testing.T) {
+			pattern, err := globToRegexp(test.glob)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if matches := pattern.MatchString(test.path); matches != test.matches {
+				t.Fatalf("expected %q to match %q: %v, got %v (%s)", test.glob, test.path, test.matches, matches, pattern)
+			}
+		})
+	}
+}
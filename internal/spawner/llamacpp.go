@@ -0,0 +1,106 @@
+package spawner
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// llama-server loads the model, and possibly downloads it, before it is
+// ready, so it gets more time than ollama.
+const llamaCppReadyTimeout = 10 * time.Minute
+
+// LlamaCppSpawner runs a llama.cpp llama-server serving a single model, either
+// a local .gguf file or a Hugging Face repository.
+type LlamaCppSpawner struct {
+	Url          url.URL
+	Model        string
+	Binary       string
+	Args         []string
+	ReadyTimeout time.Duration
+	PollInterval time.Duration
+	cmd          *exec.Cmd
+	done         <-chan struct{}
+}
+
+func NewLlamaCppSpawner(server config.Server, model string) *LlamaCppSpawner {
+	return &LlamaCppSpawner{
+		Model:        model,
+		Binary:       cmp.Or(server.Binary, "llama-server"),
+		Args:         server.Args,
+		ReadyTimeout: cmp.Or(server.ReadyTimeout, llamaCppReadyTimeout),
+		PollInterval: cmp.Or(server.ReadyPollInterval, defaultReadyPollInterval),
+	}
+}
+
+func (s *LlamaCppSpawner) Spawn(ctx context.Context) error {
+	modelFlag := "-hf"
+	if strings.HasSuffix(strings.ToLower(s.Model), ".gguf") {
+		modelFlag = "-m"
+	}
+
+	server, err := (&serverProcess{
+		name: "llama-server",
+		command: func(port int) *exec.Cmd {
+			// --jinja enables the chat templates needed for tool calling
+			args := []string{"--host", "127.0.0.1", "--port", strconv.Itoa(port), modelFlag, s.Model, "--jinja"}
+
+			return exec.Command(s.Binary, append(args, s.Args...)...)
+		},
+		healthy:        s.healthy,
+		readyTimeout:   s.ReadyTimeout,
+		pollInterval:   s.PollInterval,
+		reportsAddress: true,
+	}).start(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.Url = server.url
+	s.cmd = server.cmd
+	s.done = server.exited
+
+	return nil
+}
+
+func (s *LlamaCppSpawner) exited() <-chan struct{} {
+	return s.done
+}
+
+// healthy reports whether the server is up and done loading the model.
+func (s *LlamaCppSpawner) healthy(ctx context.Context, u *url.URL) error {
+	client := &http.Client{Timeout: time.Second}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.JoinPath("/health").String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("llama-server is not ready: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (s *LlamaCppSpawner) GetUrl() *url.URL {
+	return &s.Url
+}
+
+func (s *LlamaCppSpawner) Stop(ctx context.Context) error {
+	return stopProcess(ctx, s.cmd, s.done)
+}
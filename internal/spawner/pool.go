@@ -0,0 +1,145 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// DefaultPool is the pool shared by the agents of the process.
+var DefaultPool = NewPool()
+
+// Pool shares the servers between the agents using the same engine and
+// settings. A server is started by the first agent acquiring it and stopped
+// when the last one releases it.
+type Pool struct {
+	mu         sync.Mutex
+	servers    map[string]*pooledServer
+	newSpawner func(engine string, server config.Server, model string) (Spawner, error)
+}
+
+type pooledServer struct {
+	spawner Spawner
+	refs    int
+}
+
+func NewPool() *Pool {
+	return &Pool{
+		servers:    make(map[string]*pooledServer),
+		newSpawner: NewSpawner,
+	}
+}
+
+// Acquire returns a running server for the engine, starting it if no agent
+// is using one with the same settings. The returned spawner releases the
+// server when stopped.
+func (p *Pool) Acquire(ctx context.Context, engine string, server config.Server, model string) (Spawner, error) {
+	key := poolKey(engine, server, model)
+
+	// Held while spawning, so agents setting up concurrently wait for the
+	// same server instead of starting their own
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, ok := p.servers[key]; ok {
+		s.refs++
+
+		slog.Info("Sharing server", "engine", engine, "url", s.spawner.GetUrl().String(), "agents", s.refs)
+
+		return &sharedSpawner{pool: p, key: key, spawner: s.spawner}, nil
+	}
+
+	s, err := p.newSpawner(engine, server, model)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Spawn(ctx); err != nil {
+		// Don't leave a half started server behind
+		if stopErr := s.Stop(ctx); stopErr != nil {
+			slog.Error("Error stopping server:", "engine", engine, "error", stopErr)
+		}
+
+		return nil, err
+	}
+
+	p.servers[key] = &pooledServer{spawner: s, refs: 1}
+
+	return &sharedSpawner{pool: p, key: key, spawner: s}, nil
+}
+
+// release drops a reference to the server of key, stopping it when it was
+// the last one.
+func (p *Pool) release(ctx context.Context, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.servers[key]
+	if !ok {
+		return nil
+	}
+
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+
+	delete(p.servers, key)
+
+	return s.spawner.Stop(ctx)
+}
+
+// poolKey identifies the servers that can be shared. llama-server serves a
+// single model, so spawned llama.cpp servers are only shared by agents on
+// the same model.
+func poolKey(engine string, server config.Server, model string) string {
+	if engine != config.EngineLlamaCpp || server.URL != "" {
+		model = ""
+	}
+
+	return fmt.Sprintf("%s|%s|%s|%s|%q|%s", engine, server.URL, server.APIKey, server.Binary, strings.Join(server.Args, "\x00"), model)
+}
+
+// sharedSpawner is the reference an agent holds on a pooled server.
+type sharedSpawner struct {
+	pool     *Pool
+	key      string
+	spawner  Spawner
+	released sync.Once
+}
+
+// Spawn does nothing, the server is already running once acquired.
+func (s *sharedSpawner) Spawn(ctx context.Context) error {
+	return nil
+}
+
+func (s *sharedSpawner) GetUrl() *url.URL {
+	return s.spawner.GetUrl()
+}
+
+// Recover recovers the shared server when it can be restarted.
+func (s *sharedSpawner) Recover(ctx context.Context) (bool, error) {
+	r, ok := s.spawner.(Recoverer)
+	if !ok {
+		return false, errors.ErrUnsupported
+	}
+
+	return r.Recover(ctx)
+}
+
+// Stop releases the server, stopping it if no other agent is using it.
+func (s *sharedSpawner) Stop(ctx context.Context) error {
+	var err error
+
+	s.released.Do(func() {
+		err = s.pool.release(ctx, s.key)
+	})
+
+	return err
+}
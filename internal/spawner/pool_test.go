@@ -0,0 +1,164 @@
+package spawner
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// countingSpawner counts the servers started and stopped by a pool.
+type countingSpawner struct {
+	spawns *atomic.Int32
+	stops  *atomic.Int32
+}
+
+func (s *countingSpawner) Spawn(ctx context.Context) error {
+	s.spawns.Add(1)
+
+	return nil
+}
+
+func (s *countingSpawner) Stop(ctx context.Context) error {
+	s.stops.Add(1)
+
+	return nil
+}
+
+func (s *countingSpawner) GetUrl() *url.URL {
+	return &url.URL{Scheme: "http", Host: "127.0.0.1:11434"}
+}
+
+func testPool() (*Pool, *atomic.Int32, *atomic.Int32) {
+	spawns, stops := &atomic.Int32{}, &atomic.Int32{}
+
+	p := NewPool()
+	p.newSpawner = func(engine string, server config.Server, model string) (Spawner, error) {
+		return &countingSpawner{spawns: spawns, stops: stops}, nil
+	}
+
+	return p, spawns, stops
+}
+
+func TestPoolStopsServerOnLastRelease(t *testing.T) {
+	p, spawns, stops := testPool()
+
+	first, err := p.Acquire(t.Context(), config.EngineOllama, config.Server{}, "gemma3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := p.Acquire(t.Context(), config.EngineOllama, config.Server{}, "qwen3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := spawns.Load(); n != 1 {
+		t.Fatalf("expected the agents to share one server, %d were started", n)
+	}
+
+	// Stopping twice releases a single reference
+	for range 2 {
+		if err := first.Stop(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := stops.Load(); n != 0 {
+		t.Fatalf("expected the server to run while an agent uses it, it was stopped %d times", n)
+	}
+
+	if err := second.Stop(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := stops.Load(); n != 1 {
+		t.Fatalf("expected the last release to stop the server once, it was stopped %d times", n)
+	}
+
+	// The next agent gets a new server
+	third, err := p.Acquire(t.Context(), config.EngineOllama, config.Server{}, "gemma3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := spawns.Load(); n != 2 {
+		t.Fatalf("expected a new server once the last one was stopped, %d were started", n)
+	}
+
+	if err := third.Stop(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolConcurrentAgents(t *testing.T) {
+	p, spawns, stops := testPool()
+
+	const agents = 20
+
+	var wg sync.WaitGroup
+
+	spawners := make(chan Spawner, agents)
+
+	for range agents {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			s, err := p.Acquire(t.Context(), config.EngineOllama, config.Server{}, "gemma3")
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			spawners <- s
+		}()
+	}
+
+	wg.Wait()
+	close(spawners)
+
+	if n := spawns.Load(); n != 1 {
+		t.Fatalf("expected the agents to share one server, %d were started", n)
+	}
+
+	for s := range spawners {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := s.Stop(t.Context()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := stops.Load(); n != 1 {
+		t.Fatalf("expected the server to be stopped once, it was stopped %d times", n)
+	}
+}
+
+func TestPoolSeparatesLlamaCppModels(t *testing.T) {
+	p, spawns, _ := testPool()
+
+	for _, model := range []string{"gemma3", "qwen3", "gemma3"} {
+		s, err := p.Acquire(t.Context(), config.EngineLlamaCpp, config.Server{}, model)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer s.Stop(t.Context()) //nolint:errcheck
+	}
+
+	if n := spawns.Load(); n != 2 {
+		t.Fatalf("expected one server per model, %d were started", n)
+	}
+}
@@ -0,0 +1,85 @@
+package spawner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
+)
+
+// healthPaths are the endpoints answering once the server of each engine is
+// ready to serve requests.
+var healthPaths = map[string]string{
+	config.EngineOllama:   "/",
+	config.EngineLlamaCpp: "/health",
+	config.EngineOpenAI:   "/v1/models",
+}
+
+// RemoteSpawner attaches to a server that is already running, it starts and
+// stops nothing.
+type RemoteSpawner struct {
+	Url        url.URL
+	APIKey     string
+	HealthPath string
+}
+
+func NewRemoteSpawner(engine string, server config.Server) (*RemoteSpawner, error) {
+	if server.URL == "" {
+		return nil, fmt.Errorf("the server url is required to attach to an existing server")
+	}
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url %q: %w", server.URL, err)
+	}
+
+	// The clients add the API version themselves
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/v1")
+
+	return &RemoteSpawner{
+		Url:        *u,
+		APIKey:     server.APIKey,
+		HealthPath: healthPaths[engine],
+	}, nil
+}
+
+// Spawn checks that the server is reachable.
+func (s *RemoteSpawner) Spawn(ctx context.Context) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Url.JoinPath(s.HealthPath).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("server at %s is not reachable: %w", s.Url.String(), err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("server at %s is not usable: %s", s.Url.String(), resp.Status)
+	}
+
+	slog.Info("Using existing server", "url", s.Url.String())
+
+	return nil
+}
+
+func (s *RemoteSpawner) GetUrl() *url.URL {
+	return &s.Url
+}
+
+func (s *RemoteSpawner) Stop(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,294 @@
+package spawner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/process"
+)
+
+const (
+	defaultReadyPollInterval = 100 * time.Millisecond
+	stopGracePeriod          = 10 * time.Second
+	maxBindAttempts          = 3
+	maxLineLength            = 64 * 1024
+	outputWaitDelay          = 5 * time.Second
+)
+
+var (
+	// listeningPattern matches the log line where ollama and llama-server
+	// report the address they listen on
+	listeningPattern = regexp.MustCompile(`(?i)listening on (?:https?://)?([^\s"]+:\d+)`)
+	bindErrorPattern = regexp.MustCompile(`(?i)address already in use|(couldn't|could not|failed to) bind`)
+)
+
+var errAddressInUse = errors.New("address already in use")
+
+// serverProcess describes how to run the server of an engine. The servers
+// with reportsAddress set log the address they listen on, and are only
+// health checked once they did.
+type serverProcess struct {
+	name           string
+	command        func(port int) *exec.Cmd
+	healthy        func(ctx context.Context, u *url.URL) error
+	readyTimeout   time.Duration
+	pollInterval   time.Duration
+	reportsAddress bool
+}
+
+// runningServer is a server process that became ready.
+type runningServer struct {
+	cmd    *exec.Cmd
+	url    url.URL
+	exited <-chan struct{}
+}
+
+// start runs the server on a free port, picking another one when the server
+// fails to bind it, as it may have been taken since it was found free.
+func (p *serverProcess) start(ctx context.Context) (*runningServer, error) {
+	var err error
+
+	for attempt := 1; attempt <= maxBindAttempts; attempt++ {
+		port, portErr := findFreePort()
+		if portErr != nil {
+			return nil, fmt.Errorf("failed to find free port: %w", portErr)
+		}
+
+		var server *runningServer
+
+		server, err = p.run(ctx, port)
+		if !errors.Is(err, errAddressInUse) {
+			return server, err
+		}
+
+		slog.Warn("Port already in use, retrying on another one", "engine", p.name, "port", port, "attempt", attempt)
+	}
+
+	return nil, err
+}
+
+// run starts the server process on port, logging its output, and waits until
+// it reports it can serve requests. The process runs in its own group and
+// is killed if it doesn't become ready.
+func (p *serverProcess) run(ctx context.Context, port int) (*runningServer, error) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("127.0.0.1:%d", port),
+	}
+
+	slog.Info("Server will be available at", "engine", p.name, "url", u.String())
+
+	cmd := p.command(port)
+	process.Group(cmd)
+
+	listening := make(chan string, 1)
+
+	var bindFailed atomic.Bool
+
+	scan := func(line string) {
+		if m := listeningPattern.FindStringSubmatch(line); m != nil {
+			select {
+			case listening <- m[1]:
+			default:
+			}
+		}
+
+		if bindErrorPattern.MatchString(line) {
+			bindFailed.Store(true)
+		}
+	}
+
+	// Copied by exec, so the whole output is scanned once Wait returns
+	cmd.Stdout = &lineWriter{name: p.name + " stdout", scan: scan}
+	cmd.Stderr = &lineWriter{name: p.name + " stderr", scan: scan}
+
+	// The output goes through pipes, which a child of the server could keep
+	// open after it exits and block Wait forever
+	cmd.WaitDelay = outputWaitDelay
+
+	// Start the server process
+	waited, err := process.Start(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", p.name, err)
+	}
+
+	// Create channels for process monitoring and connection status
+	processDone := make(chan error, 1)
+	exited := make(chan struct{})
+	serverReady := make(chan url.URL, 1)
+
+	// Monitor the process
+	go func() {
+		processDone <- <-waited
+		close(exited)
+	}()
+
+	readyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	useReported := func(addr string) {
+		if reported := listenURL(addr); reported.Host != u.Host {
+			slog.Info("Server reported another address", "engine", p.name, "url", reported.String())
+
+			u = reported
+		}
+	}
+
+	// Check for server readiness, on the address reported by the server
+	// when it differs from the expected one
+	go func() {
+		// Until the server reports its address, whatever answers on the
+		// port may be another process that got it first
+		if p.reportsAddress {
+			select {
+			case <-readyCtx.Done():
+				return
+			case addr := <-listening:
+				useReported(addr)
+			}
+		}
+
+		for {
+			select {
+			case addr := <-listening:
+				useReported(addr)
+			default:
+			}
+
+			if err := p.healthy(readyCtx, &u); err == nil {
+				serverReady <- u
+				return
+			}
+
+			select {
+			case <-readyCtx.Done():
+				return
+			case <-time.After(p.pollInterval):
+			}
+		}
+	}()
+
+	failed := func(waitErr error) error {
+		err := fmt.Errorf("%s process failed: %w", p.name, waitErr)
+
+		if bindFailed.Load() {
+			err = fmt.Errorf("%w: %w", errAddressInUse, err)
+		}
+
+		return err
+	}
+
+	// Wait for either server ready or process failure
+	select {
+	case u := <-serverReady:
+		// A server that exited meanwhile didn't answer the check itself
+		select {
+		case waitErr := <-processDone:
+			err = failed(waitErr)
+		default:
+			slog.Info("Server is ready", "engine", p.name, "url", u.String())
+
+			return &runningServer{cmd: cmd, url: u, exited: exited}, nil
+		}
+	case waitErr := <-processDone:
+		err = failed(waitErr)
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-time.After(p.readyTimeout):
+		err = fmt.Errorf("timeout waiting for %s server to start after %s", p.name, p.readyTimeout)
+	}
+
+	// The server or its children may still be running
+	if killErr := process.KillGroup(cmd); killErr != nil {
+		slog.Error("Error killing server:", "engine", p.name, "error", killErr)
+	}
+
+	<-exited
+
+	return nil, err
+}
+
+// listenURL returns the url to reach a server listening on addr.
+func listenURL(addr string) url.URL {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return url.URL{Scheme: "http", Host: addr}
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	return url.URL{Scheme: "http", Host: net.JoinHostPort(host, port)}
+}
+
+// lineWriter logs the output of a server line by line, passing every line
+// to scan.
+type lineWriter struct {
+	name string
+	scan func(line string)
+	buf  []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := strings.TrimRight(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+
+		slog.Debug(w.name, "line", line)
+		w.scan(line)
+	}
+
+	// Don't hold on to output that never ends its line
+	if len(w.buf) > maxLineLength {
+		slog.Debug(w.name, "line", string(w.buf))
+		w.buf = w.buf[:0]
+	}
+
+	return len(p), nil
+}
+
+func findFreePort() (int, error) {
+	addr, err := net.ResolveTCPAddr("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// stopProcess asks the server process of cmd to exit and waits for it,
+// killing its whole group after the grace period or once ctx is done.
+func stopProcess(ctx context.Context, cmd *exec.Cmd, exited <-chan struct{}) error {
+	if cmd == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stopGracePeriod)
+	defer cancel()
+
+	return process.Terminate(ctx, cmd, exited)
+}
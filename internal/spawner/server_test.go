@@ -0,0 +1,113 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// foreignServer answers the health checks on a port, like another process
+// that got the port first.
+func foreignServer(t *testing.T) int {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func testProcess(script string) *serverProcess {
+	return &serverProcess{
+		name: "test",
+		command: func(port int) *exec.Cmd {
+			return exec.Command("sh", "-c", fmt.Sprintf(script, port))
+		},
+		healthy: func(ctx context.Context, u *url.URL) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+			if err != nil {
+				return err
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+
+			return resp.Body.Close()
+		},
+		readyTimeout:   5 * time.Second,
+		pollInterval:   10 * time.Millisecond,
+		reportsAddress: true,
+	}
+}
+
+func TestRunDoesNotAttachToForeignServer(t *testing.T) {
+	port := foreignServer(t)
+
+	// The server takes a while to fail binding the taken port
+	p := testProcess(`sleep 0.3; echo "listen tcp 127.0.0.1:%d: bind: address already in use" >&2; exit 1`)
+
+	server, err := p.run(context.Background(), port)
+	if !errors.Is(err, errAddressInUse) {
+		t.Fatalf("expected the bind failure to be reported, got %v, %v", server, err)
+	}
+}
+
+func TestRunWaitsForReportedAddress(t *testing.T) {
+	port := foreignServer(t)
+
+	// Stands in for a server that listens on the port once it logged so
+	p := testProcess(`sleep 0.1; echo "Listening on 127.0.0.1:%d"; exec sleep 10`)
+
+	server, err := p.run(context.Background(), port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := stopProcess(context.Background(), server.cmd, server.exited); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if server.url.Host != net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) {
+		t.Fatalf("expected the reported address, got %s", server.url.String())
+	}
+}
+
+func TestRunFailsWhenServerExits(t *testing.T) {
+	port := foreignServer(t)
+
+	// Reports its address, but exits while being checked
+	p := testProcess(`echo "Listening on 127.0.0.1:%d"; exit 3`)
+
+	healthy := p.healthy
+	p.healthy = func(ctx context.Context, u *url.URL) error {
+		time.Sleep(300 * time.Millisecond)
+
+		return healthy(ctx, u)
+	}
+
+	if server, err := p.run(context.Background(), port); err == nil {
+		t.Fatalf("expected the exited server not to be ready, got %s", server.url.String())
+	}
+}
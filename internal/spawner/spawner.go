@@ -2,20 +2,36 @@ package spawner
 
 import (
 	"context"
+	"fmt"
 	"net/url"
+
+	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
 )
 
 type Spawner interface {
 	Spawn(ctx context.Context) error
-	Stop() error
+	Stop(ctx context.Context) error
 	GetUrl() *url.URL
 }
 
-func NewSpawner(engine string) Spawner {
+// NewSpawner returns the spawner of the engine, serving model when the
+// server needs to know it at startup. When the server url is configured the
+// spawner attaches to that server instead of starting one.
+func NewSpawner(engine string, server config.Server, model string) (Spawner, error) {
+	if server.URL != "" {
+		if _, ok := healthPaths[engine]; ok {
+			return NewRemoteSpawner(engine, server)
+		}
+	}
+
 	switch engine {
-	case "ollama":
-		return NewOllamaSpawner()
+	case config.EngineOllama:
+		return Supervise(NewOllamaSpawner(server)), nil
+	case config.EngineLlamaCpp:
+		return Supervise(NewLlamaCppSpawner(server, model)), nil
+	case config.EngineOpenAI:
+		return NewRemoteSpawner(engine, server)
 	default:
-		return nil
+		return nil, fmt.Errorf("unknown engine %q, expected one of %q, %q or %q", engine, config.EngineOllama, config.EngineLlamaCpp, config.EngineOpenAI)
 	}
 }
@@ -0,0 +1,278 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckInterval = 5 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+	maxHealthFailures   = 3
+	maxRestartAttempts  = 5
+	initialRestartDelay = time.Second
+	maxRestartDelay     = 30 * time.Second
+)
+
+// supervised is implemented by the spawners running a server process.
+type supervised interface {
+	Spawner
+	exited() <-chan struct{}
+	healthy(ctx context.Context, u *url.URL) error
+}
+
+// Recoverer is implemented by the spawners able to bring their server back
+// after a crash.
+type Recoverer interface {
+	// Recover checks the server after a failed request, restarting it when
+	// it is down, and reports whether it was restarted. It blocks until the
+	// server is ready again.
+	Recover(ctx context.Context) (bool, error)
+}
+
+// Supervisor watches the server of a spawner for the whole run and restarts
+// it on a fresh port when the process exits or stops answering the health
+// checks. Clients must reconnect to GetUrl once it is restarted.
+type Supervisor struct {
+	spawner supervised
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu         sync.Mutex
+	url        url.URL
+	done       <-chan struct{}
+	ready      chan struct{}
+	restarting bool
+	err        error
+}
+
+func Supervise(s supervised) *Supervisor {
+	return &Supervisor{spawner: s}
+}
+
+func (s *Supervisor) Spawn(ctx context.Context) error {
+	if err := s.spawner.Spawn(ctx); err != nil {
+		return err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.url = *s.spawner.GetUrl()
+	s.done = s.spawner.exited()
+	s.ready = make(chan struct{})
+	close(s.ready)
+
+	s.wg.Add(1)
+	go s.monitor()
+
+	return nil
+}
+
+func (s *Supervisor) GetUrl() *url.URL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.url
+
+	return &u
+}
+
+// Stop ends the supervision, aborting any restart, and stops the server.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		// Under the lock so no restart begins once stopping
+		s.mu.Lock()
+		s.cancel()
+		s.mu.Unlock()
+
+		s.wg.Wait()
+	}
+
+	return s.spawner.Stop(ctx)
+}
+
+func (s *Supervisor) Recover(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	var ready <-chan struct{} = s.ready
+	restarting := s.restarting
+	s.mu.Unlock()
+
+	if !restarting {
+		done, err := s.check(ctx)
+		if err == nil {
+			return false, nil
+		}
+
+		ready = s.restart("request failed", done)
+	}
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return false, s.err
+	}
+
+	if s.ctx.Err() != nil {
+		return false, errors.New("the server was stopped")
+	}
+
+	return true, nil
+}
+
+// monitor checks the server until the supervision stops, restarting it
+// when the process exits or too many health checks fail in a row.
+func (s *Supervisor) monitor() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		s.mu.Lock()
+		ready := s.ready
+		s.mu.Unlock()
+
+		// Wait for a restart triggered by a request to finish
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ready:
+		}
+
+		s.mu.Lock()
+		done, failed := s.done, s.err != nil
+		s.mu.Unlock()
+
+		if failed {
+			return
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-done:
+			failures = 0
+			s.restart("process exited", done)
+		case <-ticker.C:
+			if checked, err := s.check(s.ctx); err != nil {
+				failures++
+
+				slog.Warn("Server health check failed", "url", s.GetUrl().String(), "failures", failures, "error", err)
+
+				if failures >= maxHealthFailures {
+					failures = 0
+					s.restart("health checks failed", checked)
+				}
+			} else {
+				failures = 0
+			}
+		}
+	}
+}
+
+// check checks the current server and returns its exited channel, which
+// identifies the server that was checked.
+func (s *Supervisor) check(ctx context.Context) (<-chan struct{}, error) {
+	s.mu.Lock()
+	u, done := s.url, s.done
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+		return done, errors.New("the server process exited")
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	return done, s.spawner.healthy(ctx, &u)
+}
+
+// restart starts restarting the server that exits on done unless a restart
+// is already running, or it was already replaced by one, and returns the
+// channel closed once it is done.
+func (s *Supervisor) restart(reason string, done <-chan struct{}) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.restarting || s.err != nil || s.ctx.Err() != nil || s.done != done {
+		return s.ready
+	}
+
+	slog.Warn("Restarting server", "url", s.url.String(), "reason", reason)
+
+	s.restarting = true
+	s.ready = make(chan struct{})
+
+	s.wg.Add(1)
+	go s.respawn(s.ready)
+
+	return s.ready
+}
+
+// respawn stops the old server and spawns a new one, retrying with backoff.
+func (s *Supervisor) respawn(ready chan struct{}) {
+	defer s.wg.Done()
+
+	var err error
+
+	delay := initialRestartDelay
+
+	for attempt := 1; attempt <= maxRestartAttempts; attempt++ {
+		if stopErr := s.spawner.Stop(s.ctx); stopErr != nil {
+			slog.Debug("Error stopping server:", "error", stopErr)
+		}
+
+		if err = s.spawner.Spawn(s.ctx); err == nil {
+			break
+		}
+
+		slog.Error("Error restarting server:", "attempt", attempt, "error", err)
+
+		if attempt == maxRestartAttempts {
+			break
+		}
+
+		select {
+		case <-s.ctx.Done():
+		case <-time.After(delay):
+		}
+
+		if s.ctx.Err() != nil {
+			err = s.ctx.Err()
+			break
+		}
+
+		delay = min(delay*2, maxRestartDelay)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.err = fmt.Errorf("server could not be restarted: %w", err)
+	} else {
+		s.url = *s.spawner.GetUrl()
+		s.done = s.spawner.exited()
+
+		slog.Info("Server restarted", "url", s.url.String())
+	}
+
+	s.restarting = false
+	close(ready)
+}
@@ -0,0 +1,137 @@
+package spawner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// fakeServer stands for a server process, each spawn gets a new port.
+type fakeServer struct {
+	mu     sync.Mutex
+	spawns int
+	done   chan struct{}
+}
+
+func (s *fakeServer) Spawn(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spawns++
+	s.done = make(chan struct{})
+
+	return nil
+}
+
+func (s *fakeServer) Stop(ctx context.Context) error {
+	s.crash()
+
+	return nil
+}
+
+func (s *fakeServer) GetUrl() *url.URL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", 8000+s.spawns)}
+}
+
+func (s *fakeServer) exited() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+func (s *fakeServer) healthy(ctx context.Context, u *url.URL) error {
+	select {
+	case <-s.exited():
+		return errors.New("connection refused")
+	default:
+		return nil
+	}
+}
+
+// crash ends the current process, if it is still running.
+func (s *fakeServer) crash() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+func (s *fakeServer) spawned() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.spawns
+}
+
+func TestRecoverRestartsDeadServerOnce(t *testing.T) {
+	for range 100 {
+		server := &fakeServer{}
+		supervisor := Supervise(server)
+
+		if err := supervisor.Spawn(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		server.crash()
+
+		// Every request interrupted by the crash recovers the server
+		var wg sync.WaitGroup
+
+		for range 10 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if _, err := supervisor.Recover(t.Context()); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := server.spawned(); n != 2 {
+			t.Fatalf("expected the server to be restarted once, it was started %d times", n)
+		}
+
+		if supervisor.GetUrl().Host != "127.0.0.1:8002" {
+			t.Fatalf("expected the url of the restarted server, got %s", supervisor.GetUrl())
+		}
+	}
+}
+
+func TestRecoverKeepsHealthyServer(t *testing.T) {
+	server := &fakeServer{}
+	supervisor := Supervise(server)
+
+	if err := supervisor.Spawn(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+	restarted, err := supervisor.Recover(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restarted || server.spawned() != 1 {
+		t.Fatalf("expected a healthy server not to be restarted, restarted %v, started %d times", restarted, server.spawned())
+	}
+}
@@ -6,20 +6,32 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/Al-Pragliola/poc-dev-agents/internal/agent"
+	"github.com/Al-Pragliola/poc-dev-agents/internal/approval"
 	"github.com/Al-Pragliola/poc-dev-agents/internal/config"
 	"github.com/Al-Pragliola/poc-dev-agents/internal/scheduler"
 	"gopkg.in/yaml.v3"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	os.Exit(run())
+}
+
+// run executes the whole project and returns the process exit code, so the
+// deferred teardown of the agents runs before exiting.
+func run() int {
 	var config config.Config
 	agents := make(map[string]*agent.Agent)
 
 	configFile := flag.String("config", "config.yaml", "The path to the config file")
 	outputFolder := flag.String("output", "output", "The path to the output folder")
+	resume := flag.Bool("resume", false, "Resume the previous run from the state saved in the output folder")
 
 	flag.Parse()
 
@@ -27,77 +39,150 @@ func main() {
 	if err != nil {
 		slog.Error("Error reading config file:", "error", err)
 
-		return
+		return 1
 	}
 
 	err = yaml.Unmarshal(yamlFile, &config)
 	if err != nil {
 		slog.Error("Error unmarshalling config file:", "error", err)
 
-		return
+		return 1
 	}
 
 	slog.Info("The goal for the project is: ", "goal", config.Goal)
 
-	err = os.MkdirAll(*outputFolder, 0755)
+	approvalPolicy, err := approval.NewPolicy(config.Approval)
 	if err != nil {
-		slog.Error("Error creating output folder:", "error", err)
+		slog.Error("Error configuring command approval:", "error", err)
 
-		return
+		return 1
 	}
 
-	for _, a := range config.Agents {
-		agents[a.Name] = agent.NewAgent(config.Engine, a)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		if err := agents[a.Name].Setup(); err != nil {
-			slog.Error("Error setting up agent:", "error", err)
+	err = os.MkdirAll(*outputFolder, 0755)
+	if err != nil {
+		slog.Error("Error creating output folder:", "error", err)
 
-			return
-		}
+		return 1
 	}
 
+	// Registered first so the servers of the agents already set up are
+	// released when a later one fails. It runs on every exit path, signals
+	// included, and waits for the servers to stop.
 	defer func() {
+		teardownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
 		for _, a := range agents {
-			if err := a.Teardown(); err != nil {
+			if err := a.Teardown(teardownCtx); err != nil {
 				slog.Error("Error tearing down agent:", "error", err)
 			}
 		}
 	}()
 
-	resp, err := agents["project-manager"].Chat(context.Background(), config.Goal)
-	if err != nil {
-		slog.Error("Error:", "error", err)
+	taskScheduler := scheduler.NewTaskScheduler(ctx, nil, *outputFolder)
+	taskScheduler.MaxConcurrency = config.MaxConcurrency
+	taskScheduler.RetryPolicy = config.Retry
+	taskScheduler.MaxReviews = config.MaxReviews
+	taskScheduler.ReportToManager = config.ReportToManager
+	taskScheduler.ToolCaller.Commands = config.Commands
+	taskScheduler.ToolCaller.Approval = approvalPolicy
+
+	// The tools are checked before any server is spawned or model pulled
+	if err := taskScheduler.ToolCaller.RegisterExternal(config.Tools, filepath.Dir(*configFile)); err != nil {
+		slog.Error("Error registering tools:", "error", err)
+
+		return 1
+	}
+
+	if err := taskScheduler.ToolCaller.ValidateAgents(config.Agents); err != nil {
+		slog.Error("Error validating agent tools:", "error", err)
 
-		return
+		return 1
+	}
+
+	// Read before any server is spawned, so a missing state fails fast
+	var state *scheduler.State
+
+	if *resume {
+		state, err = taskScheduler.Store.Load()
+		if err != nil {
+			slog.Error("Error loading state:", "error", err)
+
+			return 1
+		}
 	}
 
-	if resp.Message != "" {
-		slog.Debug("The response from the project manager is: ", "response", resp.Message)
+	for _, a := range config.Agents {
+		agents[a.Name] = agent.NewAgent(config.Engine, config.Server, a)
+
+		if err := agents[a.Name].Setup(ctx); err != nil {
+			slog.Error("Error setting up agent:", "error", err)
+
+			return 1
+		}
+
+		taskScheduler.AddAgent(a.Name, agents[a.Name])
 	}
 
-	if len(resp.ToolsCalls) > 0 {
-		slog.Debug("The tools calls from the project manager are: ", "toolsCalls", resp.ToolsCalls)
+	if config.Manager != "" {
+		taskScheduler.Manager = config.Manager
 	}
 
-	taskScheduler := scheduler.NewTaskScheduler(agents, *outputFolder)
+	if *resume {
+		slog.Info("Resuming previous run", "state", taskScheduler.Store.Path(), "tasks", len(state.Tasks))
 
-	for _, toolCall := range resp.ToolsCalls {
-		_, err := taskScheduler.ToolCaller.Call(toolCall.Function.Name, toolCall.Function.Arguments)
+		taskScheduler.Restore(state)
+	} else {
+		manager, ok := agents[taskScheduler.Manager]
+		if !ok {
+			slog.Error("Manager agent not found:", "manager", taskScheduler.Manager)
+
+			return 1
+		}
+
+		resp, err := manager.ChatWithTools(ctx, config.Goal, taskScheduler.ToolExecutor(taskScheduler.Manager))
 		if err != nil {
-			slog.Error("Error calling tool:", "error", err)
-			return
+			slog.Error("Error:", "error", err)
+
+			return 1
+		}
+
+		if resp.Message != "" {
+			slog.Debug("The response from the project manager is: ", "response", resp.Message)
 		}
+
+		taskScheduler.SaveState()
 	}
 
-	// Create a channel to listen for OS signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Start the task scheduler in the background
+	done := taskScheduler.Start()
+
+	// Wait for the run to complete or for a signal
+	select {
+	case err := <-done:
+		if err != nil {
+			slog.Error("The run did not succeed:", "error", err)
+
+			return 1
+		}
 
-	// Start the task scheduler in a goroutine
-	go taskScheduler.Run()
+		slog.Info("The run completed successfully")
+
+		return 0
+	case <-ctx.Done():
+	}
 
-	// Wait for signal
-	<-sigChan
 	slog.Info("Shutting down...")
-	taskScheduler.Stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := taskScheduler.Stop(shutdownCtx); err != nil {
+		slog.Error("Error stopping task scheduler:", "error", err)
+	}
+
+	return 1
 }